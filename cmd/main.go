@@ -7,8 +7,11 @@ import (
 	"os"
 
 	"github.com/seanenck/blap/internal/cli"
+	"github.com/seanenck/blap/internal/core"
 	"github.com/seanenck/blap/internal/fetch/retriever"
+	"github.com/seanenck/blap/internal/logging"
 	"github.com/seanenck/blap/internal/processing"
+	"github.com/seanenck/blap/internal/scaffold"
 	"github.com/seanenck/blap/internal/util"
 )
 
@@ -16,7 +19,7 @@ var version = "development"
 
 func main() {
 	if err := run(); err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		fmt.Fprintf(os.Stderr, "error: %s\n", logging.Redact(err.Error()))
 		os.Exit(1)
 	}
 }
@@ -30,9 +33,19 @@ func run() error {
 	cmd := args[1]
 	switch cmd {
 	case cli.CompletionsCommand:
-		return cli.GenerateCompletions(os.Stdout)
+		shell := ""
+		switch len(args) {
+		case 2:
+		case 3:
+			shell = args[2]
+		default:
+			return errors.New("only one shell can be set for completions")
+		}
+		return cli.GenerateCompletions(os.Stdout, shell)
 	case "help":
 		return cli.Usage(os.Stdout)
+	case cli.ManCommand:
+		return cli.Manual(os.Stdout, version)
 	case string(cli.PurgeCommand):
 		commandType = cli.PurgeCommand
 	case string(cli.ListCommand):
@@ -42,6 +55,10 @@ func run() error {
 		return nil
 	case string(cli.UpgradeCommand):
 		commandType = cli.UpgradeCommand
+	case string(cli.AddCommand):
+		commandType = cli.AddCommand
+	case string(cli.LogsCommand):
+		commandType = cli.LogsCommand
 	default:
 		return fmt.Errorf("unknown argument: %s", cmd)
 	}
@@ -62,6 +79,9 @@ func run() error {
 			}
 		}
 	}
+	if commandType == cli.AddCommand {
+		return add(*ctx, input)
+	}
 	if input == "" || !util.PathExists(input) {
 		return fmt.Errorf("config file not set or does not exist: %s", input)
 	}
@@ -69,8 +89,35 @@ func run() error {
 	if err != nil {
 		return err
 	}
-	if commandType == cli.ListCommand {
+	switch commandType {
+	case cli.ListCommand:
 		return cfg.List(os.Stdout)
+	case cli.LogsCommand:
+		return cfg.Logs(os.Stdout, ctx.ApplicationNames()[0])
 	}
 	return cfg.Process(cfg, &retriever.ResourceFetcher{Context: *ctx}, util.CommandRunner{})
 }
+
+func add(ctx cli.Settings, input string) error {
+	fetcher := &retriever.ResourceFetcher{Context: ctx}
+	if input != "" && util.PathExists(input) {
+		cfg, err := processing.Load(input, ctx)
+		if err != nil {
+			return err
+		}
+		fetcher.SetConnections(cfg.Connections)
+	}
+	def, err := scaffold.Generate(fetcher, ctx.Add.URL, ctx.Add.Name)
+	if err != nil {
+		return err
+	}
+	if ctx.Add.Include == "" {
+		return def.Write(os.Stdout)
+	}
+	include := core.Resolved(ctx.Add.Include).String()
+	if err := def.Append(include); err != nil {
+		return err
+	}
+	ctx.LogCore(logging.ConfigCategory, "added %s to: %s\n", def.Name, include)
+	return nil
+}
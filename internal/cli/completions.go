@@ -7,6 +7,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"text/template"
 )
@@ -21,18 +22,24 @@ type (
 			Purge   string
 			Upgrade string
 			List    string
+			Add     string
+			Logs    string
 		}
 		Params struct {
 			Upgrade string
 			Purge   string
 			List    string
+			Add     string
 		}
 		Arg struct {
 			Applications string
 			ForceDeploy  string
+			Offline      string
 			Negate       string
 			Confirm      string
 			CleanDirs    string
+			Name         string
+			Include      string
 		}
 	}
 )
@@ -44,8 +51,13 @@ func readFile(file string) ([]byte, error) {
 	return files.ReadFile(filepath.Join(completionsDir, file))
 }
 
-// GenerateCompletions will generate shell completions
-func GenerateCompletions(w io.Writer) error {
+// CompletionShells are the shells that completions can be generated for
+func CompletionShells() []string {
+	return []string{"bash", "fish", "zsh"}
+}
+
+// GenerateCompletions will generate shell completions (for the given shell or $SHELL if not set)
+func GenerateCompletions(w io.Writer, shell string) error {
 	if w == nil {
 		return nil
 	}
@@ -54,26 +66,32 @@ func GenerateCompletions(w io.Writer) error {
 	comp.Command.List = string(ListCommand)
 	comp.Command.Purge = string(PurgeCommand)
 	comp.Command.Upgrade = string(UpgradeCommand)
+	comp.Command.Add = string(AddCommand)
+	comp.Command.Logs = string(LogsCommand)
 	comp.Arg.Confirm = displayCommitFlag
 	comp.Arg.Applications = displayApplicationsFlag
 	comp.Arg.CleanDirs = displayCleanDirFlag
 	comp.Arg.ForceDeploy = displayReDeployFlag
+	comp.Arg.Offline = displayOfflineFlag
 	comp.Arg.Negate = displayNegateFlag
+	comp.Arg.Name = displayNameFlag
+	comp.Arg.Include = displayIncludeFlag
 
-	file := filepath.Base(os.Getenv("SHELL"))
-	switch file {
-	case "bash":
-	case "zsh":
-	default:
+	file := shell
+	if file == "" {
+		file = filepath.Base(os.Getenv("SHELL"))
+	}
+	if !slices.Contains(CompletionShells(), file) {
 		return fmt.Errorf("unable to generate completions for shell")
 	}
 	text, err := readFile(fmt.Sprintf("completions.%s", file))
 	if err != nil {
 		return err
 	}
-	comp.Params.Purge = strings.Join([]string{comp.Arg.Confirm, comp.Arg.CleanDirs}, " ")
-	comp.Params.Upgrade = strings.Join([]string{comp.Arg.Confirm, comp.Arg.Applications, comp.Arg.Negate, comp.Arg.ForceDeploy}, " ")
+	comp.Params.Purge = strings.Join([]string{comp.Arg.Confirm, comp.Arg.Applications, comp.Arg.Negate, comp.Arg.CleanDirs}, " ")
+	comp.Params.Upgrade = strings.Join([]string{comp.Arg.Confirm, comp.Arg.Applications, comp.Arg.Negate, comp.Arg.ForceDeploy, comp.Arg.Offline}, " ")
 	comp.Params.List = strings.Join([]string{comp.Arg.Applications, comp.Arg.Negate}, " ")
+	comp.Params.Add = strings.Join([]string{comp.Arg.Name, comp.Arg.Include}, " ")
 	t, err := template.New("sh").Parse(string(text))
 	if err != nil {
 		return err
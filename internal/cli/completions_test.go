@@ -10,30 +10,41 @@ import (
 )
 
 func TestGenerationCompletions(t *testing.T) {
-	if err := cli.GenerateCompletions(nil); err != nil {
+	if err := cli.GenerateCompletions(nil, ""); err != nil {
 		t.Errorf("invalid error: %v", err)
 	}
 	os.Clearenv()
 	var buf bytes.Buffer
 	t.Setenv("SHELL", "x/a")
-	if err := cli.GenerateCompletions(&buf); err == nil || err.Error() != "unable to generate completions for shell" {
+	if err := cli.GenerateCompletions(&buf, ""); err == nil || err.Error() != "unable to generate completions for shell" {
 		t.Errorf("invalid error: %v", err)
 	}
 	buf = bytes.Buffer{}
 	t.Setenv("SHELL", "bash")
-	if err := cli.GenerateCompletions(&buf); err != nil {
+	if err := cli.GenerateCompletions(&buf, ""); err != nil {
 		t.Errorf("invalid error: %v", err)
 	}
 	b := buf.String()
-	if !strings.Contains(b, "local ") {
+	if !strings.Contains(b, "local ") || !strings.Contains(b, "--include") {
 		t.Errorf("invalid buffer: %s", b)
 	}
 	t.Setenv("SHELL", "zsh")
-	if err := cli.GenerateCompletions(&buf); err != nil {
+	if err := cli.GenerateCompletions(&buf, ""); err != nil {
 		t.Errorf("invalid error: %v", err)
 	}
 	b = buf.String()
 	if !strings.Contains(b, "main") {
 		t.Errorf("invalid buffer: %s", b)
 	}
+	buf = bytes.Buffer{}
+	if err := cli.GenerateCompletions(&buf, "fish"); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	b = buf.String()
+	if !strings.Contains(b, "__fish_use_subcommand") || !strings.Contains(b, "__blap_applications") {
+		t.Errorf("invalid buffer: %s", b)
+	}
+	if err := cli.GenerateCompletions(&buf, "a"); err == nil || err.Error() != "unable to generate completions for shell" {
+		t.Errorf("invalid error: %v", err)
+	}
 }
@@ -14,12 +14,16 @@ const (
 
 // DefaultConfigs is the list of options for config files
 func DefaultConfigs() []string {
+	return defaultConfigs(os.Getenv)
+}
+
+func defaultConfigs(getenv func(string) string) []string {
 	var opts []string
 	for k, v := range map[string]string{
 		"HOME":            ".config",
 		"XDG_CONFIG_HOME": "",
 	} {
-		p := os.Getenv(k)
+		p := getenv(k)
 		if p == "" {
 			continue
 		}
@@ -6,6 +6,7 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"strings"
 )
 
 const (
@@ -15,81 +16,141 @@ const (
 	PurgeCommand CommandType = "purge"
 	// UpgradeCommand is used to update packages
 	UpgradeCommand CommandType = "upgrade"
+	// AddCommand scaffolds a new application definition
+	AddCommand CommandType = "add"
+	// LogsCommand displays the latest output log for an application
+	LogsCommand CommandType = "logs"
 	// VersionCommand displays version information
 	VersionCommand = "version"
 	// CompletionsCommand generates completions
 	CompletionsCommand = "completions"
+	// ManCommand generates the manual page
+	ManCommand = "man"
 	// CommitFlag confirms and therefore commits changes
 	CommitFlag = "commit"
 	// VerbosityFlag changes logging output
 	VerbosityFlag = "verbosity"
+	// LogCategoriesFlag enables debug logging for only the selected categories
+	LogCategoriesFlag = "log-categories"
 	// ApplicationsFlag enables selected applications
 	ApplicationsFlag = "filter-applications"
 	// CleanDirFlag indicates directory cleanup should occur
 	CleanDirFlag = "directories"
 	// ReDeployFlag will indicate all apps should ignore the redeployment rules and force redeploy
 	ReDeployFlag = "force-redeploy"
+	// OfflineFlag will resolve versions/archives from cached data only (no network)
+	OfflineFlag = "offline"
 	// NegateFilter means to IGNORE filter applications
-	NegateFilter            = "negate-filter"
+	NegateFilter = "negate-filter"
+	// NameFlag sets the application name when adding
+	NameFlag = "name"
+	// IncludeFlag sets the include file to write to when adding
+	IncludeFlag             = "include"
 	isFlag                  = "--"
 	displayApplicationsFlag = isFlag + ApplicationsFlag
 	displayVerbosityFlag    = isFlag + VerbosityFlag
+	displayLogCategories    = isFlag + LogCategoriesFlag
 	displayCommitFlag       = isFlag + CommitFlag
 	displayCleanDirFlag     = isFlag + CleanDirFlag
 	displayReDeployFlag     = isFlag + ReDeployFlag
+	displayOfflineFlag      = isFlag + OfflineFlag
 	displayNegateFlag       = isFlag + NegateFilter
+	displayNameFlag         = isFlag + NameFlag
+	displayIncludeFlag      = isFlag + IncludeFlag
 )
 
-// CommandType are top-level commands
-type CommandType string
+type (
+	// CommandType are top-level commands
+	CommandType string
+
+	multiFlag []string
+)
+
+func (m *multiFlag) String() string {
+	return strings.Join(*m, ",")
+}
+
+func (m *multiFlag) Set(value string) error {
+	*m = append(*m, value)
+	return nil
+}
 
 // Parse will parse arguments to settings
 func Parse(w io.Writer, t CommandType, args []string) (*Settings, error) {
-	var appFilter string
+	var appFilters multiFlag
+	var appNames []string
 	var negateFilter bool
 	var cleanDirs bool
 	var isReDeploy bool
+	var isOffline bool
+	var add AddSettings
 	dryRun := true
 	verbosity := InfoVerbosity
+	var logCategories string
 	if len(args) > 0 {
 		set := flag.NewFlagSet("app", flag.ContinueOnError)
-		verbose := set.Int(VerbosityFlag, InfoVerbosity, "set verbosity level")
-		var apps *string
+		verbose := set.Int(VerbosityFlag, InfoVerbosity, flagDefinitions[VerbosityFlag])
+		categories := set.String(LogCategoriesFlag, "", flagDefinitions[LogCategoriesFlag])
 		var reDeploy *bool
+		var offline *bool
 		var dirs *bool
 		var negate *bool
 		var commit *bool
+		var name *string
+		var include *string
 		switch t {
-		case PurgeCommand:
-			dirs = set.Bool(CleanDirFlag, false, "cleanup orphaned directories")
-		case ListCommand, UpgradeCommand:
-			apps = set.String(ApplicationsFlag, "", "filter processed applications")
-			negate = set.Bool(NegateFilter, false, "negate application filter")
-			if t == UpgradeCommand {
-				reDeploy = set.Bool(ReDeployFlag, false, "redeploy all applications")
+		case AddCommand:
+			name = set.String(NameFlag, "", flagDefinitions[NameFlag])
+			include = set.String(IncludeFlag, "", flagDefinitions[IncludeFlag])
+		case ListCommand, PurgeCommand, UpgradeCommand:
+			set.Var(&appFilters, ApplicationsFlag, flagDefinitions[ApplicationsFlag])
+			negate = set.Bool(NegateFilter, false, flagDefinitions[NegateFilter])
+			switch t {
+			case PurgeCommand:
+				dirs = set.Bool(CleanDirFlag, false, flagDefinitions[CleanDirFlag])
+			case UpgradeCommand:
+				reDeploy = set.Bool(ReDeployFlag, false, flagDefinitions[ReDeployFlag])
+				offline = set.Bool(OfflineFlag, false, flagDefinitions[OfflineFlag])
 			}
 		}
 		needCommit := t == PurgeCommand || t == UpgradeCommand
 		if needCommit {
-			commit = set.Bool(CommitFlag, false, "confirm and commit changes")
+			commit = set.Bool(CommitFlag, false, flagDefinitions[CommitFlag])
 		}
-		if err := set.Parse(args); err != nil {
+		positional, err := parseInterspersed(set, args)
+		if err != nil {
 			return nil, err
 		}
 		verbosity = *verbose
 		if verbosity < 0 {
 			return nil, fmt.Errorf("verbosity must be >= 0 (%d)", verbosity)
 		}
+		logCategories = *categories
 		switch t {
-		case PurgeCommand:
-			cleanDirs = *dirs
-		case ListCommand, UpgradeCommand:
-			appFilter = *apps
+		case AddCommand:
+			if len(positional) > 1 {
+				return nil, fmt.Errorf("only one url can be added: %v", positional)
+			}
+			if len(positional) == 1 {
+				add.URL = positional[0]
+			}
+			add.Name = *name
+			add.Include = *include
+		case LogsCommand:
+			appNames = positional
+		case ListCommand, PurgeCommand, UpgradeCommand:
+			appNames = positional
 			negateFilter = *negate
+			if dirs != nil {
+				cleanDirs = *dirs
+			}
 			if reDeploy != nil {
 				isReDeploy = *reDeploy
 			}
-			if negateFilter && len(appFilter) == 0 {
+			if offline != nil {
+				isOffline = *offline
+			}
+			if negateFilter && len(appFilters) == 0 && len(appNames) == 0 {
 				return nil, errors.New("negate used without filters")
 			}
 		}
@@ -100,16 +161,66 @@ func Parse(w io.Writer, t CommandType, args []string) (*Settings, error) {
 			}
 		}
 	}
+	if t == AddCommand && add.URL == "" {
+		return nil, errors.New("url required to add an application")
+	}
+	if t == LogsCommand && len(appNames) != 1 {
+		return nil, errors.New("one application is required to view logs")
+	}
 	ctx := &Settings{
-		CleanDirs: cleanDirs,
-		DryRun:    dryRun,
-		Verbosity: verbosity,
-		Purge:     t == PurgeCommand,
-		Writer:    w,
-		ReDeploy:  isReDeploy,
+		CleanDirs:  cleanDirs,
+		DryRun:     dryRun,
+		Verbosity:  verbosity,
+		categories: &categoryFilter{},
+		Purge:      t == PurgeCommand,
+		Writer:     w,
+		ReDeploy:   isReDeploy,
+		Offline:    isOffline,
+		Add:        add,
+	}
+	if err := ctx.SetLogCategories(true, logCategories); err != nil {
+		return nil, err
 	}
-	if err := ctx.CompileApplicationFilter(appFilter, negateFilter); err != nil {
+	if err := ctx.CompileApplicationFilters(appFilters, appNames, negateFilter); err != nil {
 		return nil, err
 	}
 	return ctx, nil
 }
+
+func parseInterspersed(set *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := set.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := set.Args()
+		if terminated(set, args[:len(args)-len(rest)]) {
+			return append(positional, rest...), nil
+		}
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// terminated checks if the parsed (flag) args ended at a '--' terminator (not a flag value)
+func terminated(set *flag.FlagSet, parsed []string) bool {
+	for idx := 0; idx < len(parsed); idx++ {
+		arg := parsed[idx]
+		if arg == isFlag {
+			return true
+		}
+		name := strings.TrimLeft(arg, "-")
+		if strings.Contains(name, "=") {
+			continue
+		}
+		if f := set.Lookup(name); f != nil {
+			if b, ok := f.Value.(interface{ IsBoolFlag() bool }); !ok || !b.IsBoolFlag() {
+				idx++
+			}
+		}
+	}
+	return false
+}
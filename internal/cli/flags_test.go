@@ -1,10 +1,12 @@
 package cli_test
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 
 	"github.com/seanenck/blap/internal/cli"
+	"github.com/seanenck/blap/internal/logging"
 )
 
 func TestParseDefaults(t *testing.T) {
@@ -99,3 +101,119 @@ func TestParse(t *testing.T) {
 		t.Errorf("invalid result: %v", c)
 	}
 }
+
+func TestParseAdd(t *testing.T) {
+	if _, err := cli.Parse(nil, cli.AddCommand, []string{}); err == nil || err.Error() != "url required to add an application" {
+		t.Errorf("invalid error: %v", err)
+	}
+	if _, err := cli.Parse(nil, cli.AddCommand, []string{"a", "b"}); err == nil || err.Error() != "only one url can be added: [a b]" {
+		t.Errorf("invalid error: %v", err)
+	}
+	c, err := cli.Parse(nil, cli.AddCommand, []string{"https://github.com/x/y", "-name", "abc", "--include", "file.toml"})
+	if err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if c.Add.URL != "https://github.com/x/y" || c.Add.Name != "abc" || c.Add.Include != "file.toml" || !c.DryRun {
+		t.Errorf("invalid result: %v", c.Add)
+	}
+	if _, err := cli.Parse(nil, cli.AddCommand, []string{"-commit", "x"}); err == nil {
+		t.Error("commit is not valid for add")
+	}
+}
+
+func TestParseApplications(t *testing.T) {
+	c, err := cli.Parse(nil, cli.UpgradeCommand, []string{"nvim", "-commit", "lockbox", "-filter-applications=^go", "--filter-applications", "rg$"})
+	if err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if c.DryRun || !c.FilterApplications() || fmt.Sprintf("%v", c.ApplicationNames()) != "[nvim lockbox]" {
+		t.Errorf("invalid result: %v", c)
+	}
+	for k, v := range map[string]bool{
+		"nvim":     true,
+		"lockbox":  true,
+		"golang":   true,
+		"ripgrep":  false,
+		"rg":       true,
+		"nvim2":    false,
+		"xlockbox": false,
+	} {
+		if c.AllowApplication(k) != v {
+			t.Errorf("invalid filter for: %s", k)
+		}
+	}
+	c, err = cli.Parse(nil, cli.PurgeCommand, []string{"nvim", "--negate-filter"})
+	if err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if !c.Purge || c.AllowApplication("nvim") || !c.AllowApplication("go") {
+		t.Errorf("invalid result: %v", c)
+	}
+	c, err = cli.Parse(nil, cli.ListCommand, []string{"nvim"})
+	if err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if !c.AllowApplication("nvim") || c.AllowApplication("go") {
+		t.Errorf("invalid result: %v", c)
+	}
+	if _, err := cli.Parse(nil, cli.ListCommand, []string{"-filter-applications", "*"}); err == nil {
+		t.Error("invalid regex should fail")
+	}
+	c, err = cli.Parse(nil, cli.UpgradeCommand, []string{"nvim", "--", "foo", "--commit", "-"})
+	if err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if !c.DryRun || fmt.Sprintf("%v", c.ApplicationNames()) != "[nvim foo --commit -]" {
+		t.Errorf("invalid result: %v %v", c.DryRun, c.ApplicationNames())
+	}
+	c, err = cli.Parse(nil, cli.UpgradeCommand, []string{"--filter-applications", "--", "nvim", "-commit"})
+	if err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if c.DryRun || fmt.Sprintf("%v", c.ApplicationNames()) != "[nvim]" {
+		t.Errorf("invalid result: %v %v", c.DryRun, c.ApplicationNames())
+	}
+}
+
+func TestParseLogs(t *testing.T) {
+	if _, err := cli.Parse(nil, cli.LogsCommand, []string{}); err == nil || err.Error() != "one application is required to view logs" {
+		t.Errorf("invalid error: %v", err)
+	}
+	if _, err := cli.Parse(nil, cli.LogsCommand, []string{"a", "b"}); err == nil || err.Error() != "one application is required to view logs" {
+		t.Errorf("invalid error: %v", err)
+	}
+	s, err := cli.Parse(nil, cli.LogsCommand, []string{"a"})
+	if err != nil || fmt.Sprintf("%v", s.ApplicationNames()) != "[a]" {
+		t.Errorf("invalid names: %v", err)
+	}
+}
+
+func TestParseOffline(t *testing.T) {
+	s, err := cli.Parse(nil, cli.UpgradeCommand, []string{"--offline"})
+	if err != nil || !s.Offline {
+		t.Errorf("invalid offline: %v", err)
+	}
+	if _, err := cli.Parse(nil, cli.PurgeCommand, []string{"--offline"}); err == nil {
+		t.Error("offline is only for upgrades")
+	}
+}
+
+func TestParseLogCategories(t *testing.T) {
+	if _, err := cli.Parse(nil, cli.UpgradeCommand, []string{"--log-categories", "github,other"}); err == nil || err.Error() != "unknown log category: other" {
+		t.Errorf("invalid error: %v", err)
+	}
+	s, err := cli.Parse(nil, cli.ListCommand, []string{"--log-categories", "github, fetch"})
+	if err != nil || !s.CategoryEnabled(logging.GitHubCategory) || !s.CategoryEnabled(logging.FetchCategory) || s.CategoryEnabled(logging.BuildCategory) {
+		t.Errorf("invalid categories: %v", err)
+	}
+	if err := s.SetLogCategories(false, "build"); err != nil || s.CategoryEnabled(logging.BuildCategory) {
+		t.Errorf("flag categories should take precedence: %v", err)
+	}
+	s, _ = cli.Parse(nil, cli.ListCommand, []string{})
+	if !s.CategoryEnabled(logging.BuildCategory) {
+		t.Error("all categories should be enabled")
+	}
+	if err := s.SetLogCategories(false, "build"); err != nil || !s.CategoryEnabled(logging.BuildCategory) || s.CategoryEnabled(logging.FetchCategory) {
+		t.Errorf("invalid categories: %v", err)
+	}
+}
@@ -9,10 +9,62 @@ import (
 	"strings"
 
 	"github.com/seanenck/blap/internal/core"
+	"github.com/seanenck/blap/internal/logging"
 )
 
 const exe = "blap"
 
+type (
+	commandDefinition struct {
+		name  string
+		args  string
+		text  string
+		flags []string
+	}
+)
+
+var flagDefinitions = map[string]string{
+	ApplicationsFlag:  "filter packages to process (regex, repeatable)",
+	NegateFilter:      "negate the filtered packages",
+	CommitFlag:        "confirm and commit changes for actions",
+	ReDeployFlag:      "redeploy all packages (ignoring application flags)",
+	OfflineFlag:       "only use cached lookups and existing archives (no network)",
+	CleanDirFlag:      "cleanup orphan directories during purge",
+	NameFlag:          "application name (defaults from the url)",
+	IncludeFlag:       "include file to append the application to",
+	VerbosityFlag:     "increase/decrease output verbosity",
+	LogCategoriesFlag: "only enable debug logging for these (comma-separated) categories",
+}
+
+func commandDefinitions() []commandDefinition {
+	const withApps = "[app...]"
+	return []commandDefinition{
+		{name: VersionCommand, text: "display version information"},
+		{name: string(ListCommand), args: withApps, text: "list managed package set", flags: []string{ApplicationsFlag, NegateFilter}},
+		{name: string(UpgradeCommand), args: withApps, text: "upgrade packages", flags: []string{ApplicationsFlag, NegateFilter, ReDeployFlag, OfflineFlag, CommitFlag}},
+		{name: string(PurgeCommand), args: withApps, text: "purge old versions", flags: []string{ApplicationsFlag, NegateFilter, CleanDirFlag, CommitFlag}},
+		{name: string(LogsCommand), args: "<app>", text: "display the latest (extract/build) output log for an application"},
+		{name: string(AddCommand), args: "<url>", text: "scaffold an application from a repository/web url", flags: []string{NameFlag, IncludeFlag}},
+		{name: CompletionsCommand, args: "[shell]", text: fmt.Sprintf("generate shell completions (%s)", strings.Join(CompletionShells(), ", "))},
+		{name: ManCommand, text: "generate the manual page (roff)"},
+	}
+}
+
+func categoryNames() []string {
+	var names []string
+	for _, c := range logging.Categories() {
+		names = append(names, string(c))
+	}
+	return names
+}
+
+func (c commandDefinition) usage() string {
+	if c.args == "" {
+		return c.name
+	}
+	return fmt.Sprintf("%s %s", c.name, c.args)
+}
+
 func helpLine(w io.Writer, sub bool, flag, text string) {
 	spacing := ""
 	if sub {
@@ -34,25 +86,15 @@ func help(w io.Writer) error {
 	if w == nil {
 		return errors.New("nil writer")
 	}
-	filterFlags := func() {
-		helpLine(w, true, displayApplicationsFlag, "filter packages to process (regex)")
-		helpLine(w, true, displayNegateFlag, "negate the filtered packages")
-	}
-	commitFlag := func() {
-		helpLine(w, true, displayCommitFlag, "confirm and commit changes for actions")
-	}
 	fmt.Fprintf(w, "%s\n", exe)
-	helpLine(w, false, VersionCommand, "display version information")
-	helpLine(w, false, string(ListCommand), "list managed package set")
-	filterFlags()
-	helpLine(w, false, string(UpgradeCommand), "upgrade packages")
-	filterFlags()
-	helpLine(w, true, displayReDeployFlag, "redeploy all packages (ignoring application flags)")
-	commitFlag()
-	helpLine(w, false, string(PurgeCommand), "purge old versions")
-	helpLine(w, true, displayCleanDirFlag, "cleanup orphan directories during purge")
-	commitFlag()
-	helpLine(w, false, displayVerbosityFlag, "increase/decrease output verbosity")
+	for _, cmd := range commandDefinitions() {
+		helpLine(w, false, cmd.usage(), cmd.text)
+		for _, f := range cmd.flags {
+			helpLine(w, true, isFlag+f, flagDefinitions[f])
+		}
+	}
+	helpLine(w, false, displayVerbosityFlag, flagDefinitions[VerbosityFlag])
+	helpLine(w, false, displayLogCategories, fmt.Sprintf("%s (%s)", flagDefinitions[LogCategoriesFlag], strings.Join(categoryNames(), ", ")))
 	fmt.Fprintln(w)
 	fmt.Fprintln(w, "configuration file locations:")
 	for _, c := range DefaultConfigs() {
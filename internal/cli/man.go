@@ -0,0 +1,66 @@
+// Package cli handles manual page output
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/seanenck/blap/internal/core"
+)
+
+var roffEscape = strings.NewReplacer(`\`, `\e`, "-", `\-`)
+
+func roff(in string) string {
+	out := roffEscape.Replace(in)
+	if strings.HasPrefix(out, ".") || strings.HasPrefix(out, "'") {
+		return `\&` + out
+	}
+	return out
+}
+
+// Manual writes the manual page (roff)
+func Manual(w io.Writer, version string) error {
+	if w == nil {
+		return errors.New("nil writer")
+	}
+	upper := strings.ToUpper(exe)
+	fmt.Fprintf(w, ".TH %s 1 \"\" \"%s %s\" \"User Commands\"\n", upper, exe, roff(version))
+	fmt.Fprintln(w, ".SH NAME")
+	fmt.Fprintf(w, "%s \\- manage binaries and source downloaded from upstreams\n", exe)
+	fmt.Fprintln(w, ".SH SYNOPSIS")
+	fmt.Fprintf(w, ".B %s\n.I command\n[\\fIoptions\\fR]\n", exe)
+	fmt.Fprintln(w, ".SH COMMANDS")
+	for _, cmd := range commandDefinitions() {
+		if cmd.args == "" {
+			fmt.Fprintf(w, ".TP\n.B %s\n", roff(cmd.name))
+		} else {
+			fmt.Fprintf(w, ".TP\n.BI %s \" %s\"\n", roff(cmd.name), roff(cmd.args))
+		}
+		fmt.Fprintln(w, roff(cmd.text))
+		if len(cmd.flags) == 0 {
+			continue
+		}
+		fmt.Fprintln(w, ".RS")
+		for _, f := range cmd.flags {
+			fmt.Fprintf(w, ".TP\n.B %s\n%s\n", roff(isFlag+f), roff(flagDefinitions[f]))
+		}
+		fmt.Fprintln(w, ".RE")
+	}
+	fmt.Fprintln(w, ".SH OPTIONS")
+	fmt.Fprintf(w, ".TP\n.BI %s \" level\"\n%s (default: %d)\n", roff(displayVerbosityFlag), roff(flagDefinitions[VerbosityFlag]), InfoVerbosity)
+	fmt.Fprintf(w, ".TP\n.BI %s \" categories\"\n%s (%s)\n", roff(displayLogCategories), roff(flagDefinitions[LogCategoriesFlag]), roff(strings.Join(categoryNames(), ", ")))
+	fmt.Fprintln(w, ".SH FILES")
+	for _, c := range defaultConfigs(func(key string) string {
+		return fmt.Sprintf("$%s", key)
+	}) {
+		fmt.Fprintf(w, ".TP\n.I %s\nconfiguration file\n", roff(c))
+	}
+	fmt.Fprintln(w, ".SH ENVIRONMENT")
+	fmt.Fprintf(w, ".TP\n.B %s\nconfiguration file override\n", roff(ConfigFileEnv))
+	for _, e := range (core.GitHubSettings{}).Env() {
+		fmt.Fprintf(w, ".TP\n.B %s\ngithub token (to handle github rate limiting)\n", roff(e))
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package cli_test
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/seanenck/blap/internal/cli"
+)
+
+func TestManual(t *testing.T) {
+	if err := cli.Manual(nil, ""); err == nil || err.Error() != "nil writer" {
+		t.Errorf("invalid error: %v", err)
+	}
+	os.Clearenv()
+	t.Setenv("HOME", "xxxxx")
+	var buf bytes.Buffer
+	if err := cli.Manual(&buf, "v1.0"); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	s := buf.String()
+	for _, need := range []string{
+		".TH BLAP 1 \"\" \"blap v1.0\"",
+		".BI upgrade \" [app...]\"",
+		`.B \-\-force\-redeploy`,
+		`$HOME/.config/blap/config.toml`,
+		`$XDG_CONFIG_HOME/blap/config.toml`,
+		"BLAP_CONFIG_FILE",
+		"BLAP_GITHUB_TOKEN",
+	} {
+		if !strings.Contains(s, need) {
+			t.Errorf("missing %s: %s", need, s)
+		}
+	}
+	if strings.Contains(s, "xxxxx") {
+		t.Errorf("should not use environment: %s", s)
+	}
+}
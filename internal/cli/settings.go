@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/exec"
 	"regexp"
+	"slices"
 	"strings"
 	"sync"
 
@@ -17,22 +18,47 @@ import (
 // InfoVerbosity is the default info level for outputs
 const InfoVerbosity = 2
 
-var settingsLock = &sync.Mutex{}
-
-// Settings are the core settings
-type Settings struct {
-	DryRun bool
-	Purge  bool
-	Writer io.Writer
-	filter struct {
-		has    bool
-		negate bool
-		regex  *regexp.Regexp
-	}
-	Verbosity int
-	CleanDirs bool
-	ReDeploy  bool
-}
+const debugVerbosity = 4
+
+var (
+	settingsLock   = &sync.Mutex{}
+	progressActive string
+)
+
+type (
+	categoryFilter struct {
+		explicit bool
+		names    []logging.Category
+	}
+	// Terminal allows a writer to indicate it is an (interactive) terminal
+	Terminal interface {
+		IsTerminal() bool
+	}
+	// AddSettings are the settings for scaffolding an application
+	AddSettings struct {
+		URL     string
+		Name    string
+		Include string
+	}
+	// Settings are the core settings
+	Settings struct {
+		DryRun bool
+		Purge  bool
+		Writer io.Writer
+		filter struct {
+			has    bool
+			negate bool
+			regex  []*regexp.Regexp
+			names  []string
+		}
+		Verbosity  int
+		categories *categoryFilter
+		CleanDirs  bool
+		ReDeploy   bool
+		Offline    bool
+		Add        AddSettings
+	}
+)
 
 // FilterApplications indicates if the
 func (s Settings) FilterApplications() bool {
@@ -48,23 +74,25 @@ func (s Settings) AllowApplication(input string) bool {
 	if !s.filter.has {
 		return true
 	}
-	m := s.filter.regex.MatchString(input)
+	m := slices.Contains(s.filter.names, input) || slices.ContainsFunc(s.filter.regex, func(r *regexp.Regexp) bool {
+		return r.MatchString(input)
+	})
 	if s.filter.negate {
 		m = !m
 	}
 	return m
 }
 
-// ParseToken will handle determine the appropriate token to use
-func (s Settings) ParseToken(t core.Token) (string, error) {
+// ParseToken will handle determine the appropriate token to use (reading from the given environment)
+func (s Settings) ParseToken(t core.Token, env core.Environment) (string, error) {
 	for _, t := range t.Env() {
-		v := strings.TrimSpace(os.Getenv(t))
+		v := strings.TrimSpace(env.Getenv(t))
 		if v != "" {
 			return v, nil
 		}
 	}
 	token, err := func() (string, error) {
-		token, command := t.Value()
+		token, command := t.Value(env.Getenv)
 		if token != "" {
 			return token, nil
 		}
@@ -79,7 +107,9 @@ func (s Settings) ParseToken(t core.Token) (string, error) {
 			cmd = command[0]
 			args = command[1:]
 		}
-		b, err := exec.Command(cmd, args...).Output()
+		c := exec.Command(cmd, args...)
+		c.Env = env.Environ(false)
+		b, err := c.Output()
 		if err != nil {
 			return "", err
 		}
@@ -91,37 +121,146 @@ func (s Settings) ParseToken(t core.Token) (string, error) {
 	return strings.TrimSpace(token), nil
 }
 
+// ApplicationNames are the (exact) application names requested
+func (s Settings) ApplicationNames() []string {
+	settingsLock.Lock()
+	defer settingsLock.Unlock()
+	return s.filter.names
+}
+
 // CompileApplicationFilter will compile the necessary app filter
 func (s *Settings) CompileApplicationFilter(filter string, negate bool) error {
+	var filters []string
+	if filter != "" {
+		filters = append(filters, filter)
+	}
+	return s.CompileApplicationFilters(filters, nil, negate)
+}
+
+// CompileApplicationFilters will compile a set of app filters (regex) and exact application names
+func (s *Settings) CompileApplicationFilters(filters, names []string, negate bool) error {
 	settingsLock.Lock()
 	defer settingsLock.Unlock()
-	if filter == "" {
+	s.filter.has = false
+	s.filter.negate = false
+	s.filter.regex = nil
+	s.filter.names = nil
+	var compiled []*regexp.Regexp
+	for _, f := range filters {
+		if f == "" {
+			continue
+		}
+		re, err := regexp.Compile(f)
+		if err != nil {
+			return err
+		}
+		compiled = append(compiled, re)
+	}
+	for _, n := range names {
+		if n != "" && !slices.Contains(s.filter.names, n) {
+			s.filter.names = append(s.filter.names, n)
+		}
+	}
+	if len(compiled) == 0 && len(s.filter.names) == 0 {
 		return nil
 	}
 	s.filter.has = true
 	s.filter.negate = negate
-	re, err := regexp.Compile(filter)
+	s.filter.regex = compiled
+	return nil
+}
+
+// SetLogCategories will enable debug logging for only the given categories,
+// configured categories do not override categories set via flags
+func (s Settings) SetLogCategories(explicit bool, values ...string) error {
+	cats, err := logging.ParseCategories(values...)
 	if err != nil {
 		return err
 	}
-	s.filter.regex = re
+	settingsLock.Lock()
+	defer settingsLock.Unlock()
+	if s.categories == nil || len(cats) == 0 || (s.categories.explicit && !explicit) {
+		return nil
+	}
+	s.categories.explicit = explicit
+	s.categories.names = cats
 	return nil
 }
 
+// CategoryEnabled indicates if debug logging is enabled for a category (all are enabled when not filtered)
+func (s Settings) CategoryEnabled(cat logging.Category) bool {
+	settingsLock.Lock()
+	defer settingsLock.Unlock()
+	return s.categoryEnabled(cat)
+}
+
+func (s Settings) categoryEnabled(cat logging.Category) bool {
+	if s.categories == nil || len(s.categories.names) == 0 {
+		return true
+	}
+	return slices.Contains(s.categories.names, cat)
+}
+
 func (s Settings) log(level int, cat logging.Category, msg string, a ...any) {
 	settingsLock.Lock()
 	defer settingsLock.Unlock()
-	if s.Writer != nil && s.Verbosity > level {
-		fmt.Fprintf(s.Writer, "[%s] %s", cat, fmt.Sprintf(msg, a...))
+	if s.Writer == nil {
+		return
+	}
+	enabled := s.Verbosity > level
+	if level >= debugVerbosity && s.categories != nil && len(s.categories.names) > 0 {
+		enabled = s.categoryEnabled(cat)
+	}
+	if enabled {
+		fmt.Fprintf(s.Writer, "[%s] %s", cat, logging.Redact(fmt.Sprintf(msg, a...)))
 	}
 }
 
 // LogDebug handles debug logging
 func (s Settings) LogDebug(cat logging.Category, msg string, a ...any) {
-	s.log(4, cat, msg, a...)
+	s.log(debugVerbosity, cat, msg, a...)
 }
 
 // LogCore logs a core message
 func (s Settings) LogCore(cat logging.Category, msg string, a ...any) {
 	s.log(0, cat, msg, a...)
 }
+
+// LogProgress logs progress for an item (by id) at info verbosity, done will end the line,
+// in-place updates are only rendered on a terminal and for one item at a time
+func (s Settings) LogProgress(cat logging.Category, id string, done bool, msg string, a ...any) {
+	settingsLock.Lock()
+	defer settingsLock.Unlock()
+	if s.Writer == nil || s.Verbosity < InfoVerbosity {
+		return
+	}
+	line := logging.Redact(fmt.Sprintf(msg, a...))
+	if !isTerminal(s.Writer) {
+		if done {
+			fmt.Fprintf(s.Writer, "[%s] %s\n", cat, line)
+		}
+		return
+	}
+	if progressActive != "" && progressActive != id && !done {
+		return
+	}
+	end := ""
+	progressActive = id
+	if done {
+		end = "\n"
+		progressActive = ""
+	}
+	fmt.Fprintf(s.Writer, "\r[%s] %s%s", cat, line, end)
+}
+
+func isTerminal(w io.Writer) bool {
+	if t, ok := w.(Terminal); ok {
+		return t.IsTerminal()
+	}
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
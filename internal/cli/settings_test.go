@@ -51,6 +51,59 @@ func TestLogging(t *testing.T) {
 	}
 }
 
+func TestLogCategories(t *testing.T) {
+	var buf bytes.Buffer
+	c, _ := cli.Parse(&buf, cli.ListCommand, []string{"--log-categories", "github"})
+	c.LogDebug(logging.GitHubCategory, "a")
+	c.LogDebug(logging.BuildCategory, "b")
+	c.LogCore(logging.BuildCategory, "c")
+	if s := buf.String(); s != "[github] a[build] c" {
+		t.Errorf("invalid buffer result: %s", s)
+	}
+	buf.Reset()
+	c.Verbosity = 100
+	c.LogDebug(logging.GitHubCategory, "a")
+	c.LogDebug(logging.BuildCategory, "b")
+	if s := buf.String(); s != "[github] a" {
+		t.Errorf("invalid buffer result: %s", s)
+	}
+}
+
+type terminal struct {
+	bytes.Buffer
+}
+
+func (t *terminal) IsTerminal() bool {
+	return true
+}
+
+func TestLogProgress(t *testing.T) {
+	var buf bytes.Buffer
+	c := cli.Settings{Writer: &buf, Verbosity: 1}
+	c.LogProgress(logging.FetchCategory, "a", true, "a %d", 1)
+	if s := buf.String(); s != "" {
+		t.Errorf("invalid buffer result: %s", s)
+	}
+	c.Verbosity = cli.InfoVerbosity
+	c.LogProgress(logging.FetchCategory, "a", false, "a %d", 1)
+	c.LogProgress(logging.FetchCategory, "a", true, "a %d", 2)
+	if s := buf.String(); s != "[fetch] a 2\n" {
+		t.Errorf("invalid buffer result: %q", s)
+	}
+	term := &terminal{}
+	c.Writer = term
+	c.LogProgress(logging.FetchCategory, "a", false, "a %d", 1)
+	c.LogProgress(logging.FetchCategory, "b", false, "b %d", 1)
+	c.LogProgress(logging.FetchCategory, "a", false, "a %d", 2)
+	c.LogProgress(logging.FetchCategory, "b", true, "b %d", 2)
+	c.LogProgress(logging.FetchCategory, "a", true, "a %d", 3)
+	c.LogProgress(logging.FetchCategory, "b", false, "b %d", 3)
+	c.LogProgress(logging.FetchCategory, "b", true, "b %d", 4)
+	if s := term.String(); s != "\r[fetch] a 1\r[fetch] a 2\r[fetch] b 2\n\r[fetch] a 3\n\r[fetch] b 3\r[fetch] b 4\n" {
+		t.Errorf("invalid terminal result: %q", s)
+	}
+}
+
 func TestCompileFilter(t *testing.T) {
 	c := cli.Settings{}
 	if err := c.CompileApplicationFilter("", false); err != nil {
@@ -100,40 +153,51 @@ func TestParseToken(t *testing.T) {
 	os.Clearenv()
 	defer os.Clearenv()
 	s := cli.Settings{}
-	r, err := s.ParseToken(core.GitHubSettings{})
+	r, err := s.ParseToken(core.GitHubSettings{}, core.NewEnvironment(os.Environ()))
 	if r != "" || err != nil {
 		t.Errorf("invalid result: %s %v", r, err)
 	}
-	r, err = s.ParseToken(core.GitHubSettings{Token: "abc"})
+	r, err = s.ParseToken(core.GitHubSettings{Token: "abc"}, core.NewEnvironment(os.Environ()))
 	if r != "abc" || err != nil {
 		t.Errorf("invalid result: %s %v", r, err)
 	}
 	os.Mkdir("testdata", 0o755)
 	test := filepath.Join("testdata", "test.sh")
 	os.WriteFile(test, []byte("#!/bin/sh\necho 123 $1"), 0o755)
-	r, err = s.ParseToken(core.GitHubSettings{Command: []core.Resolved{core.Resolved(test)}})
+	r, err = s.ParseToken(core.GitHubSettings{Command: []core.Resolved{core.Resolved(test)}}, core.NewEnvironment(os.Environ()))
 	if r != "123" || err != nil {
 		t.Errorf("invalid result: %s %v", r, err)
 	}
-	r, err = s.ParseToken(core.GitHubSettings{Token: "111"})
+	r, err = s.ParseToken(core.GitHubSettings{Token: "111"}, core.NewEnvironment(os.Environ()))
 	if r != "111" || err != nil {
 		t.Errorf("invalid result: %s %v", r, err)
 	}
-	r, err = s.ParseToken(core.GitHubSettings{Token: "111", Command: []core.Resolved{"x"}})
+	r, err = s.ParseToken(core.GitHubSettings{Token: "111", Command: []core.Resolved{"x"}}, core.NewEnvironment(os.Environ()))
 	if r != "111" || err != nil {
 		t.Errorf("invalid result: %s %v", r, err)
 	}
-	if _, err := s.ParseToken(core.GitHubSettings{Command: []core.Resolved{"x"}}); err == nil || !strings.Contains(err.Error(), "executable file not") {
+	if _, err := s.ParseToken(core.GitHubSettings{Command: []core.Resolved{"x"}}, core.NewEnvironment(os.Environ())); err == nil || !strings.Contains(err.Error(), "executable file not") {
 		t.Errorf("invalid result: %v", err)
 	}
 	t.Setenv("GITHUB_TOKEN", "xyz")
-	r, err = s.ParseToken(core.GitHubSettings{Token: "abc"})
+	r, err = s.ParseToken(core.GitHubSettings{Token: "abc"}, core.NewEnvironment(os.Environ()))
 	if r != "xyz" || err != nil {
 		t.Errorf("invalid result: %s %v", r, err)
 	}
 	t.Setenv("BLAP_GITHUB_TOKEN", "123")
-	r, err = s.ParseToken(core.GitHubSettings{Token: "abc"})
+	r, err = s.ParseToken(core.GitHubSettings{Token: "abc"}, core.NewEnvironment(os.Environ()))
 	if r != "123" || err != nil {
 		t.Errorf("invalid result: %s %v", r, err)
 	}
+	env := core.NewEnvironment(nil).With(core.Variables{{Key: "GITHUB_TOKEN", Value: "cfg"}})
+	r, err = s.ParseToken(core.GitHubSettings{Token: "abc"}, env)
+	if r != "cfg" || err != nil {
+		t.Errorf("invalid result: %s %v", r, err)
+	}
+	os.WriteFile(test, []byte("#!/bin/sh\necho $TOKEN_VALUE $1"), 0o755)
+	env = core.NewEnvironment(nil).With(core.Variables{{Key: "TOKEN_VALUE", Value: "456"}, {Key: "TOKEN_ARG", Value: "789"}})
+	r, err = s.ParseToken(core.GitHubSettings{Command: []core.Resolved{core.Resolved(test), "$TOKEN_ARG"}}, env)
+	if r != "456 789" || err != nil {
+		t.Errorf("invalid result: %s %v", r, err)
+	}
 }
@@ -1,20 +1,30 @@
+_{{ $.Executable }}_applications() {
+  {{ $.Executable }} {{ $.Command.List }} 2>/dev/null | sed -n 's/^(app) -> //p'
+}
+
 _{{ $.Executable }}() {
   local cur opts chosen sub subset matched
   cur=${COMP_WORDS[COMP_CWORD]}
   if [ "$COMP_CWORD" -eq 1 ]; then
-    opts="{{ $.Command.Upgrade }} {{ $.Command.Purge }} {{ $.Command.List }}"
+    opts="{{ $.Command.Upgrade }} {{ $.Command.Purge }} {{ $.Command.List }} {{ $.Command.Logs }} {{ $.Command.Add }}"
   else
     chosen=${COMP_WORDS[1]}
     subset=""
     case "$chosen" in
       "{{ $.Command.Purge }}")
-        opts="{{ $.Params.Purge }}"
+        opts="{{ $.Params.Purge }} $(_{{ $.Executable }}_applications)"
         ;;
       "{{ $.Command.Upgrade }}") 
-        opts="{{ $.Params.Upgrade }}"
+        opts="{{ $.Params.Upgrade }} $(_{{ $.Executable }}_applications)"
         ;;
       "{{ $.Command.List }}") 
-        opts="{{ $.Params.List }}"
+        opts="{{ $.Params.List }} $(_{{ $.Executable }}_applications)"
+        ;;
+      "{{ $.Command.Logs }}")
+        opts="$(_{{ $.Executable }}_applications)"
+        ;;
+      "{{ $.Command.Add }}")
+        opts="{{ $.Params.Add }}"
         ;;
     esac
     for sub in $opts; do
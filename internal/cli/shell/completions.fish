@@ -0,0 +1,11 @@
+function __{{ $.Executable }}_applications
+  {{ $.Executable }} {{ $.Command.List }} 2>/dev/null | string replace -r -f '^\(app\) -> ' ''
+end
+
+complete -c {{ $.Executable }} -f
+complete -c {{ $.Executable }} -n "__fish_use_subcommand" -a "{{ $.Command.Upgrade }} {{ $.Command.Purge }} {{ $.Command.List }} {{ $.Command.Logs }} {{ $.Command.Add }}"
+complete -c {{ $.Executable }} -n "__fish_seen_subcommand_from {{ $.Command.Upgrade }}" -a "{{ $.Params.Upgrade }} (__{{ $.Executable }}_applications)"
+complete -c {{ $.Executable }} -n "__fish_seen_subcommand_from {{ $.Command.Purge }}" -a "{{ $.Params.Purge }} (__{{ $.Executable }}_applications)"
+complete -c {{ $.Executable }} -n "__fish_seen_subcommand_from {{ $.Command.List }}" -a "{{ $.Params.List }} (__{{ $.Executable }}_applications)"
+complete -c {{ $.Executable }} -n "__fish_seen_subcommand_from {{ $.Command.Logs }}" -a "(__{{ $.Executable }}_applications)"
+complete -c {{ $.Executable }} -n "__fish_seen_subcommand_from {{ $.Command.Add }}" -a "{{ $.Params.Add }}"
@@ -45,6 +45,16 @@ type (
 	}
 )
 
+// CanExtract indicates if a file has a known extraction command
+func CanExtract(file string) bool {
+	for k := range knownExtensions {
+		if strings.HasSuffix(file, k) {
+			return true
+		}
+	}
+	return false
+}
+
 // ID attempt to get a reasonable id for file system parsing
 func (asset *Resource) ID() (string, error) {
 	h := sha256.New()
@@ -67,9 +77,28 @@ func (asset *Resource) SetAppData(name, workdir string, settings Extraction) err
 	if err != nil {
 		return err
 	}
+	archive := filepath.Join(workdir, util.CleanFileName(fmt.Sprintf("%s.%s", hash, asset.File)))
+	unpack := filepath.Join(workdir, util.CleanFileName(fmt.Sprintf("%s.%s.%s", hash, name, asset.Tag)))
+	asset.setPaths(archive, unpack, settings)
+	return nil
+}
+
+// SetExistingData will set the asset's data for an (existing) archive and unpack directory
+func (asset *Resource) SetExistingData(archive, unpack string, settings Extraction) error {
+	if archive == "" || unpack == "" {
+		return errors.New("archive and unpack paths are required")
+	}
+	if asset.Tag == "" || asset.File == "" || asset.URL == "" {
+		return errors.New("asset not initialized properly")
+	}
+	asset.setPaths(archive, unpack, settings)
+	return nil
+}
+
+func (asset *Resource) setPaths(archive, unpack string, settings Extraction) {
 	asset.Paths.set = true
-	asset.Paths.Archive = filepath.Join(workdir, util.CleanFileName(fmt.Sprintf("%s.%s", hash, asset.File)))
-	asset.Paths.Unpack = filepath.Join(workdir, util.CleanFileName(fmt.Sprintf("%s.%s.%s", hash, name, asset.Tag)))
+	asset.Paths.Archive = archive
+	asset.Paths.Unpack = unpack
 	asset.extract = settings
 	asset.extract.NoDepth = true
 	if len(settings.Command) == 0 {
@@ -84,7 +113,6 @@ func (asset *Resource) SetAppData(name, workdir string, settings Extraction) err
 			}
 		}
 	}
-	return nil
 }
 
 // Extract will unpack an asset
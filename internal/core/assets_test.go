@@ -1,6 +1,7 @@
 package core_test
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -29,6 +30,10 @@ func (m *mockExtract) Run(util.RunSettings, string, ...string) error {
 	return nil
 }
 
+func (m *mockExtract) WithContext(context.Context) util.Runner {
+	return m
+}
+
 func (m *mockExtract) Output(c string, a ...string) ([]byte, error) {
 	return m.payload, m.RunCommand(c, a...)
 }
@@ -61,6 +66,23 @@ func TestSetAppDataErrors(t *testing.T) {
 	}
 }
 
+func TestSetExistingData(t *testing.T) {
+	r := &core.Resource{}
+	if err := r.SetExistingData("", "b", core.Extraction{}); err == nil || err.Error() != "archive and unpack paths are required" {
+		t.Errorf("invalid error: %v", err)
+	}
+	if err := r.SetExistingData("a", "b", core.Extraction{}); err == nil || err.Error() != "asset not initialized properly" {
+		t.Errorf("invalid error: %v", err)
+	}
+	r = &core.Resource{File: "x.tar.gz", Tag: "1", URL: "x"}
+	if err := r.SetExistingData("a", "b", core.Extraction{}); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if r.Paths.Archive != "a" || r.Paths.Unpack != "b" {
+		t.Errorf("invalid paths: %v", r.Paths)
+	}
+}
+
 func TestExtractErrors(t *testing.T) {
 	r := &core.Resource{}
 	r.File = "file"
@@ -183,3 +205,17 @@ func TestID(t *testing.T) {
 		t.Errorf("invalid id: %s", h)
 	}
 }
+
+func TestCanExtract(t *testing.T) {
+	for k, v := range map[string]bool{
+		"a.tar.gz":  true,
+		"a.tar.xz":  true,
+		"a.zip":     true,
+		"a.tar.bz2": false,
+		"a":         false,
+	} {
+		if core.CanExtract(k) != v {
+			t.Errorf("invalid extract check: %s", k)
+		}
+	}
+}
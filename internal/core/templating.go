@@ -28,8 +28,9 @@ type (
 	// Values is the environment variables/values (for templating)
 	Values[T any] struct {
 		baseValues
-		Name string
-		Vars T
+		Name   string
+		Vars   T
+		getenv func(string) string
 	}
 )
 
@@ -38,6 +39,20 @@ func (baseValues) Getenv(key string) string {
 	return os.Getenv(key)
 }
 
+// Getenv allows for reading environment variable in templating (from the set environment)
+func (v Values[T]) Getenv(key string) string {
+	if v.getenv == nil {
+		return v.baseValues.Getenv(key)
+	}
+	return v.getenv(key)
+}
+
+// WithEnvironment will use the environment for reading environment variables in templating
+func (v Values[T]) WithEnvironment(e Environment) Values[T] {
+	v.getenv = e.Getenv
+	return v
+}
+
 // NewValues create a new environment variable set
 func NewValues[T any](name string, in T) (Values[T], error) {
 	if name == "" {
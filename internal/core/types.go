@@ -3,6 +3,7 @@ package core
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"iter"
 	"os"
@@ -11,28 +12,43 @@ import (
 	"slices"
 	"strings"
 	"text/template"
+	"time"
+
+	"github.com/seanenck/blap/internal/logging"
 )
 
 const (
+	maxRetryWait = 5 * time.Minute
 	disableFlag  = "disabled"
 	pinFlag      = "pinned"
 	redeployFlag = "redeploy"
+	// BearerCredential sends the token as a bearer authorization (default)
+	BearerCredential = "bearer"
+	// BasicCredential sends the user and token as basic authorization
+	BasicCredential = "basic"
+	// HeaderCredential sends the token as the value of a custom header
+	HeaderCredential = "header"
 )
 
+var defaultRetryStatuses = []int{429, 500, 502, 503, 504}
+
 type (
 	// WebURL can be templated with settings from the host
 	WebURL string
 	// FlagSet is a simple string array to control application rules
 	FlagSet []string
 	// Variables define os environment variables to set
-	Variables []struct {
-		Key   string
-		Value Resolved
-	}
-	// SetVariables are the variables that are set on Variables.Set and should be "unset"
-	SetVariables map[string]struct {
-		had   bool
-		value string
+	Variables []Variable
+	// Variable is an environment variable to set, secret values are redacted from logs
+	Variable struct {
+		Key    string
+		Value  Resolved
+		Secret bool
+	}
+	// Environment is an explicit (per-command) environment, it never modifies the process environment
+	Environment struct {
+		inherit []string
+		values  []string
 	}
 	// Resolved will handle env-based strings for resolution of env vars
 	Resolved string
@@ -81,6 +97,7 @@ type (
 	// Application defines how an application is downloaded, unpacked, and deployed
 	Application struct {
 		Priority  int
+		Depends   []string
 		Flags     FlagSet
 		GitHub    *GitHubMode
 		Git       *GitMode
@@ -88,6 +105,7 @@ type (
 		Exec      *RunMode
 		Static    *StaticMode
 		Extract   Extraction
+		Mirrors   []Resolved
 		Variables Variables
 		ClearEnv  bool
 		Setup     []Step
@@ -123,20 +141,58 @@ type (
 	GitHubSettings struct {
 		Token   string
 		Command []Resolved
+		Pause   uint
 	}
 	// Connections are various endpoint settings
 	Connections struct {
 		GitHub   GitHubSettings
 		Timeouts struct {
-			Get     uint
-			All     uint
-			Command uint
+			Get      uint
+			All      uint
+			Command  uint
+			Download uint
 		}
+		Retry       RetrySettings
+		Cache       CacheSettings
+		Rewrites    map[string]Resolved
+		HTTP        HTTPSettings
+		Credentials map[string]Credential
+		Netrc       Resolved
+	}
+	// Credential is an (host) authentication setting for requests
+	Credential struct {
+		Type    string
+		Header  string
+		User    string
+		Token   string
+		Command []Resolved
+	}
+	// HTTPSettings control the (shared) http client transport
+	HTTPSettings struct {
+		Proxy      Resolved
+		NoProxy    []string
+		CAFiles    []Resolved
+		ClientCert Resolved
+		ClientKey  Resolved
+		UserAgent  string
+	}
+	// CacheSettings control caching of (version) lookups
+	CacheSettings struct {
+		Disable   bool
+		Directory Resolved
+		TTL       uint
+		Expire    uint
+	}
+	// RetrySettings control retrying transient request/command failures
+	RetrySettings struct {
+		Attempts uint
+		Backoff  uint
+		Statuses []int
 	}
 	// Token defines an interface for setting API/auth tokens
 	Token interface {
 		Env() []string
-		Value() (string, []string)
+		Value(func(string) string) (string, []string)
 	}
 	// SourceType indicates if an application field contains a source
 	SourceType interface {
@@ -154,6 +210,45 @@ func (s Step) CommandEnv() CommandEnv {
 	return CommandEnv{Clear: s.ClearEnv, Variables: s.Variables}
 }
 
+// Rewrite will rewrite a URL using the (longest) matching rewrite prefix (resolved via a lookup function)
+func (c Connections) Rewrite(url string, getenv func(string) string) string {
+	match := ""
+	for prefix := range c.Rewrites {
+		if prefix != "" && len(prefix) > len(match) && strings.HasPrefix(url, prefix) {
+			match = prefix
+		}
+	}
+	if match == "" {
+		return url
+	}
+	return c.Rewrites[match].Expand(getenv) + strings.TrimPrefix(url, match)
+}
+
+// Retryable indicates if an http status code should be retried
+func (r RetrySettings) Retryable(status int) bool {
+	statuses := r.Statuses
+	if len(statuses) == 0 {
+		statuses = defaultRetryStatuses
+	}
+	return slices.Contains(statuses, status)
+}
+
+// Wait gets the (exponential) backoff to wait before the next attempt (1-based)
+func (r RetrySettings) Wait(attempt uint) time.Duration {
+	backoff := r.Backoff
+	if backoff == 0 {
+		backoff = 1000
+	}
+	wait := time.Duration(backoff) * time.Millisecond
+	for idx := uint(1); idx < attempt; idx++ {
+		wait *= 2
+		if wait >= maxRetryWait {
+			return maxRetryWait
+		}
+	}
+	return min(wait, maxRetryWait)
+}
+
 // Is toggles on source mode
 func (g GitHubMode) Is() {
 }
@@ -174,17 +269,49 @@ func (s StaticMode) Is() {
 func (r RunMode) Is() {
 }
 
+// Env will get the possible environment variables (credentials have none)
+func (c Credential) Env() []string {
+	return nil
+}
+
+// Value will get the token value or command (resolved via a lookup function)
+func (c Credential) Value(getenv func(string) string) (string, []string) {
+	var res []string
+	for _, v := range c.Command {
+		res = append(res, v.Expand(getenv))
+	}
+	return c.Token, res
+}
+
+// Check will validate credential settings
+func (c Credential) Check() error {
+	switch c.Type {
+	case "", BearerCredential:
+	case BasicCredential:
+		if c.User == "" {
+			return errors.New("basic credentials require a user")
+		}
+	case HeaderCredential:
+		if c.Header == "" {
+			return errors.New("header credentials require a header name")
+		}
+	default:
+		return fmt.Errorf("unknown credential type: %s", c.Type)
+	}
+	return nil
+}
+
 // Env will get the possible environment variables
 func (g GitHubSettings) Env() []string {
 	const gitHubToken = "GITHUB_TOKEN"
 	return []string{"BLAP_" + gitHubToken, gitHubToken}
 }
 
-// Value will get the configured token value
-func (g GitHubSettings) Value() (string, []string) {
+// Value will get the configured token value (resolved via a lookup function)
+func (g GitHubSettings) Value(getenv func(string) string) (string, []string) {
 	var res []string
 	for _, v := range g.Command {
-		res = append(res, v.String())
+		res = append(res, v.Expand(getenv))
 	}
 	return g.Token, res
 }
@@ -206,11 +333,16 @@ func (a Application) Items() iter.Seq[any] {
 
 // String will resolve ~/ and basic env vars
 func (r Resolved) String() string {
+	return r.Expand(os.Getenv)
+}
+
+// Expand will resolve ~/ and basic env vars using a lookup function
+func (r Resolved) Expand(getenv func(string) string) string {
 	v := string(r)
 	if v == "" {
 		return v
 	}
-	dir := os.Expand(v, os.Getenv)
+	dir := os.Expand(v, getenv)
 	matches := templateRegexp.FindAllString(dir, -1)
 	if len(matches) > 0 {
 		for _, m := range matches {
@@ -246,35 +378,50 @@ func (r Resolved) String() string {
 	return filepath.Join(h, strings.TrimPrefix(dir, isHome))
 }
 
-// Set will set os environment variables
-func (v Variables) Set() SetVariables {
-	vars := make(SetVariables)
-	if v == nil {
-		return vars
-	}
+// NewEnvironment will create an environment that inherits the given (os) variables
+func NewEnvironment(inherit []string) Environment {
+	return Environment{inherit: slices.Clone(inherit)}
+}
+
+// With will create a new environment with the variables set (resolved against the existing environment)
+func (e Environment) With(v Variables) Environment {
+	env := Environment{inherit: e.inherit, values: slices.Clone(e.values)}
 	for _, obj := range v {
-		value, ok := os.LookupEnv(obj.Key)
-		vars[obj.Key] = struct {
-			had   bool
-			value string
-		}{ok, value}
-		os.Setenv(obj.Key, obj.Value.String())
+		value := obj.Value.Expand(env.Getenv)
+		if obj.Secret {
+			logging.AddSecret(value)
+		}
+		env.values = append(env.values, fmt.Sprintf("%s=%s", obj.Key, value))
 	}
-	return vars
+	return env
 }
 
-// Unset will clear/reset variables to prior state
-func (v SetVariables) Unset() {
-	if v == nil {
-		return
-	}
-	for key, values := range v {
-		if values.had {
-			os.Setenv(key, values.value)
-		} else {
-			os.Unsetenv(key)
+// Set will set a (literal, unexpanded) variable value in the environment
+func (e Environment) Set(key, value string) Environment {
+	env := Environment{inherit: e.inherit, values: slices.Clone(e.values)}
+	env.values = append(env.values, fmt.Sprintf("%s=%s", key, value))
+	return env
+}
+
+// Getenv will get a variable value from the environment
+func (e Environment) Getenv(key string) string {
+	for _, set := range [][]string{e.values, e.inherit} {
+		for idx := len(set) - 1; idx >= 0; idx-- {
+			k, v, _ := strings.Cut(set[idx], "=")
+			if k == key {
+				return v
+			}
 		}
 	}
+	return ""
+}
+
+// Environ gets the environment for a command, clear will drop the inherited variables
+func (e Environment) Environ(clear bool) []string {
+	if clear {
+		return slices.Clone(e.values)
+	}
+	return append(slices.Clone(e.inherit), e.values...)
 }
 
 // Check will validate a flag set
@@ -5,8 +5,10 @@ import (
 	"os"
 	"slices"
 	"testing"
+	"time"
 
 	"github.com/seanenck/blap/internal/core"
+	"github.com/seanenck/blap/internal/logging"
 )
 
 func TestSourceItems(t *testing.T) {
@@ -53,7 +55,7 @@ func TestGitHubToken(t *testing.T) {
 	if fmt.Sprintf("%v", token.Env()) != "[BLAP_GITHUB_TOKEN GITHUB_TOKEN]" {
 		t.Errorf("invalid token: %v", token.Env())
 	}
-	val, c := token.Value()
+	val, c := token.Value(os.Getenv)
 	if val != "" || len(c) != 0 {
 		t.Errorf("invalid token: %s %v", val, c)
 	}
@@ -61,7 +63,7 @@ func TestGitHubToken(t *testing.T) {
 	if fmt.Sprintf("%v", token.Env()) != "[BLAP_GITHUB_TOKEN GITHUB_TOKEN]" {
 		t.Errorf("invalid token: %v", token.Env())
 	}
-	val, c = token.Value()
+	val, c = token.Value(os.Getenv)
 	if val != "xyz" || len(c) != 0 {
 		t.Errorf("invalid token: %s %v", val, c)
 	}
@@ -70,62 +72,50 @@ func TestGitHubToken(t *testing.T) {
 	if fmt.Sprintf("%v", token.Env()) != "[BLAP_GITHUB_TOKEN GITHUB_TOKEN]" {
 		t.Errorf("invalid token: %v", token.Env())
 	}
-	val, c = token.Value()
+	val, c = token.Value(os.Getenv)
 	if val != "$HOME/xyz" || fmt.Sprintf("%v", c) != "[zzz zzz/zzz]" {
 		t.Errorf("invalid token: %s %v", val, c)
 	}
 }
 
-func TestVarSetUnset(t *testing.T) {
+func TestEnvironment(t *testing.T) {
 	os.Clearenv()
 	defer os.Clearenv()
-	var val core.Variables
-	obj := val.Set()
-	obj.Unset()
-	val = core.Variables{}
-	obj = val.Set()
-	obj.Unset()
 	os.Setenv("HOME", "1")
-	os.Setenv("A_TEST", "0")
-	val = append(val, struct {
-		Key   string
-		Value core.Resolved
-	}{"A_TEST", "~/2"})
-	val = append(val, struct {
-		Key   string
-		Value core.Resolved
-	}{"THIS_IS_A_TEST", "3"})
-	obj = val.Set()
-	if os.Getenv("A_TEST") != "1/2" || os.Getenv("THIS_IS_A_TEST") != "3" {
-		t.Errorf("invalid env")
-	}
-	obj.Unset()
-	if os.Getenv("A_TEST") != "0" || os.Getenv("THIS_IS_A_TEST") != "" {
-		t.Errorf("invalid env: %s", os.Getenv("THIS_IS_A_TEST"))
+	var val core.Variables
+	env := core.NewEnvironment([]string{"HOME=1", "A_TEST=0"})
+	if fmt.Sprintf("%v", env.With(val).Environ(false)) != "[HOME=1 A_TEST=0]" {
+		t.Errorf("invalid env: %v", env.With(val).Environ(false))
+	}
+	val = append(val, core.Variable{Key: "A_TEST", Value: "~/2$A_TEST"})
+	val = append(val, core.Variable{Key: "THIS_IS_A_TEST", Value: "3$A_TEST"})
+	set := env.With(val)
+	if set.Getenv("A_TEST") != "1/20" || set.Getenv("THIS_IS_A_TEST") != "31/20" || set.Getenv("HOME") != "1" || set.Getenv("NONE") != "" {
+		t.Errorf("invalid env: %v", set.Environ(false))
+	}
+	if fmt.Sprintf("%v", set.Environ(false)) != "[HOME=1 A_TEST=0 A_TEST=1/20 THIS_IS_A_TEST=31/20]" {
+		t.Errorf("invalid env: %v", set.Environ(false))
+	}
+	if fmt.Sprintf("%v", set.Environ(true)) != "[A_TEST=1/20 THIS_IS_A_TEST=31/20]" {
+		t.Errorf("invalid env: %v", set.Environ(true))
+	}
+	if env.Getenv("A_TEST") != "0" || os.Getenv("A_TEST") != "" || os.Getenv("THIS_IS_A_TEST") != "" {
+		t.Error("environment was modified")
 	}
 }
 
 func TestCommandEnv(t *testing.T) {
 	a := core.Application{}
 	a.ClearEnv = true
-	a.Variables = append(a.Variables, struct {
-		Key   string
-		Value core.Resolved
-	}{})
+	a.Variables = append(a.Variables, core.Variable{})
 	e := a.CommandEnv()
 	if !e.Clear || len(e.Variables) != 1 {
 		t.Error("invalid conversion")
 	}
 	s := core.Application{}
 	s.ClearEnv = true
-	s.Variables = append(s.Variables, struct {
-		Key   string
-		Value core.Resolved
-	}{})
-	s.Variables = append(s.Variables, struct {
-		Key   string
-		Value core.Resolved
-	}{})
+	s.Variables = append(s.Variables, core.Variable{})
+	s.Variables = append(s.Variables, core.Variable{})
 	e = s.CommandEnv()
 	if !e.Clear || len(e.Variables) != 2 {
 		t.Error("invalid conversion")
@@ -297,3 +287,83 @@ func TestCommandsFromStep(t *testing.T) {
 		t.Errorf("invalid command")
 	}
 }
+
+func TestRetrySettings(t *testing.T) {
+	r := core.RetrySettings{}
+	if !r.Retryable(502) || r.Retryable(404) || r.Retryable(200) {
+		t.Error("invalid default statuses")
+	}
+	r.Statuses = []int{404}
+	if r.Retryable(502) || !r.Retryable(404) {
+		t.Error("invalid statuses")
+	}
+	if r.Wait(1) != time.Second || r.Wait(3) != 4*time.Second {
+		t.Errorf("invalid wait: %v %v", r.Wait(1), r.Wait(3))
+	}
+	r.Backoff = 100
+	if r.Wait(1) != 100*time.Millisecond || r.Wait(2) != 200*time.Millisecond || r.Wait(100) != 5*time.Minute {
+		t.Errorf("invalid wait: %v %v", r.Wait(1), r.Wait(2))
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	os.Clearenv()
+	t.Setenv("MIRROR", "https://cache.local")
+	c := core.Connections{}
+	if c.Rewrite("https://github.com/a/b", os.Getenv) != "https://github.com/a/b" {
+		t.Error("invalid rewrite")
+	}
+	c.Rewrites = map[string]core.Resolved{
+		"https://github.com/":   "$MIRROR/github/",
+		"https://github.com/a/": "$MIRROR/a/",
+		"":                      "x",
+	}
+	if r := c.Rewrite("https://github.com/a/b", os.Getenv); r != "https://cache.local/a/b" {
+		t.Errorf("invalid rewrite: %s", r)
+	}
+	if r := c.Rewrite("https://github.com/c/d", os.Getenv); r != "https://cache.local/github/c/d" {
+		t.Errorf("invalid rewrite: %s", r)
+	}
+	if r := c.Rewrite("https://gitlab.com/c/d", os.Getenv); r != "https://gitlab.com/c/d" {
+		t.Errorf("invalid rewrite: %s", r)
+	}
+}
+
+func TestCredentialCheck(t *testing.T) {
+	if err := (core.Credential{}).Check(); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if err := (core.Credential{Type: core.BasicCredential}).Check(); err == nil || err.Error() != "basic credentials require a user" {
+		t.Errorf("invalid error: %v", err)
+	}
+	if err := (core.Credential{Type: core.HeaderCredential}).Check(); err == nil || err.Error() != "header credentials require a header name" {
+		t.Errorf("invalid error: %v", err)
+	}
+	if err := (core.Credential{Type: "other"}).Check(); err == nil || err.Error() != "unknown credential type: other" {
+		t.Errorf("invalid error: %v", err)
+	}
+	if token, cmd := (core.Credential{Token: "a", Command: []core.Resolved{"b"}}).Value(os.Getenv); token != "a" || len(cmd) != 1 {
+		t.Errorf("invalid value: %s %v", token, cmd)
+	}
+}
+
+func TestSecretVariable(t *testing.T) {
+	env := core.NewEnvironment([]string{"BASE=value"}).With(core.Variables{
+		{Key: "PLAIN", Value: "plain-value"},
+		{Key: "SECRET", Value: "secret-$BASE", Secret: true},
+	})
+	if env.Getenv("SECRET") != "secret-value" {
+		t.Errorf("invalid env: %v", env.Environ(false))
+	}
+	if s := logging.Redact("plain-value secret-value"); s != "plain-value [redacted]" {
+		t.Errorf("invalid redact: %s", s)
+	}
+}
+
+func TestEnvironmentSet(t *testing.T) {
+	base := core.NewEnvironment([]string{"BASE=value"})
+	env := base.Set("LITERAL", "$BASE ~/x")
+	if env.Getenv("LITERAL") != "$BASE ~/x" || base.Getenv("LITERAL") != "" {
+		t.Errorf("invalid env: %v", env.Environ(false))
+	}
+}
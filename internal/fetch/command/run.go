@@ -38,9 +38,9 @@ func Run(caller fetch.Retriever, ctx fetch.Context, a core.RunMode) (*core.Resou
 	}
 	var args []string
 	for _, a := range a.Arguments {
-		args = append(args, a.String())
+		args = append(args, a.Expand(caller.Getenv))
 	}
-	b, err := filtered.NewBase(filtered.RawString(a.Executable.String()), a.Fetch, runFilterable{args: args})
+	b, err := filtered.NewBase(filtered.RawString(a.Executable.Expand(caller.Getenv)), a.Fetch, runFilterable{args: args})
 	if err != nil {
 		return nil, err
 	}
@@ -14,13 +14,17 @@ import (
 
 type mock struct {
 	payload []byte
+	cmd     string
+	args    []string
 }
 
 func (m *mock) Do(*http.Request) (*http.Response, error) {
 	return nil, nil
 }
 
-func (m *mock) Output(_ string, args ...string) ([]byte, error) {
+func (m *mock) Output(cmd string, args ...string) ([]byte, error) {
+	m.cmd = cmd
+	m.args = args
 	if len(args) > 0 {
 		if strings.Contains(args[0], "{{") {
 			return nil, fmt.Errorf("unexpected arg/not templated: %v", args)
@@ -64,3 +68,17 @@ func TestRun(t *testing.T) {
 		}
 	}
 }
+
+func TestRunEnvironment(t *testing.T) {
+	client := &mock{}
+	client.payload = []byte("1.2.3")
+	r := &retriever.ResourceFetcher{}
+	r.Backend = client
+	r.SetEnvironment(core.NewEnvironment(nil).With(core.Variables{{Key: "TOOL", Value: "/opt/tool"}, {Key: "CHANNEL", Value: "stable"}}))
+	if _, err := command.Run(r, fetch.Context{Name: "afa"}, core.RunMode{Executable: "$TOOL/bin/list", Arguments: []core.Resolved{"--channel", "$CHANNEL"}, Fetch: &core.Filtered{Sort: "", Download: "ajfaeaijo", Filters: []string{"(.*?)"}}}); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if client.cmd != "/opt/tool/bin/list" || fmt.Sprintf("%v", client.args) != "[--channel stable]" {
+		t.Errorf("invalid command: %s %v", client.cmd, client.args)
+	}
+}
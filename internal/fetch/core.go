@@ -2,6 +2,7 @@
 package fetch
 
 import (
+	"context"
 	"errors"
 	"iter"
 	"net/http"
@@ -14,7 +15,8 @@ import (
 type (
 	// Context is passed to processing to handle various inputs/values
 	Context struct {
-		Name string
+		Name        string
+		Environment *core.Environment
 	}
 	// Backend to override calling conventions to external sources
 	Backend interface {
@@ -23,13 +25,18 @@ type (
 	}
 	// Retriever provides the means to fetch application information
 	Retriever interface {
-		Download(bool, string, string) (bool, error)
+		Download(bool, string, string, ...string) (bool, error)
 		SetConnections(core.Connections)
+		SetContext(context.Context)
+		SetEnvironment(core.Environment)
+		Getenv(string) string
 		Process(Context, iter.Seq[any]) (*core.Resource, error)
 		GitHubFetch(ownerRepo, call string, to any) error
 		Debug(logging.Category, string, ...any)
 		ExecuteCommand(cmd string, args ...string) (string, error)
 		Get(string) (*http.Response, error)
+		Post(context.Context, string, string, []byte) error
+		Lookup(string, func() ([]byte, error)) ([]byte, error)
 	}
 	// Filterable is an interface to support arbitrary inputs that need to filter to tag sets
 	Filterable interface {
@@ -61,6 +68,9 @@ func (ctx Context) Templating(in string, vals any) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	if ctx.Environment != nil {
+		v = v.WithEnvironment(*ctx.Environment)
+	}
 	b, err := v.Template(in)
 	if err != nil {
 		return "", err
@@ -3,6 +3,7 @@ package fetch_test
 import (
 	"testing"
 
+	"github.com/seanenck/blap/internal/core"
 	"github.com/seanenck/blap/internal/fetch"
 )
 
@@ -33,6 +34,17 @@ func TestTemplating(t *testing.T) {
 	if res != "xyz" {
 		t.Errorf("invalid result: %s", res)
 	}
+	t.Setenv("BLAP_TEMPLATE_TEST", "process")
+	res, err = ctx.Templating(`{{ $.Getenv "BLAP_TEMPLATE_TEST" }}`, nil)
+	if err != nil || res != "process" {
+		t.Errorf("invalid result: %s %v", res, err)
+	}
+	env := core.NewEnvironment(nil).With(core.Variables{{Key: "BLAP_TEMPLATE_TEST", Value: "global"}})
+	ctx.Environment = &env
+	res, err = ctx.Templating(`{{ $.Getenv "BLAP_TEMPLATE_TEST" }}`, nil)
+	if err != nil || res != "global" {
+		t.Errorf("invalid result: %s %v", res, err)
+	}
 }
 
 func TestCompileRegex(t *testing.T) {
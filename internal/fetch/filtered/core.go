@@ -115,7 +115,9 @@ func (b Base) Get(r fetch.Retriever, ctx fetch.Context) (*core.Resource, error)
 	}
 
 	r.Debug(logging.FilteringCategory, "url: %s\n", up)
-	data, err := filterable.Get(r, up)
+	data, err := r.Lookup(strings.Join(append([]string{up}, b.args...), " "), func() ([]byte, error) {
+		return filterable.Get(r, up)
+	})
 	if err != nil {
 		return nil, err
 	}
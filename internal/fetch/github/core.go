@@ -4,8 +4,13 @@ package github
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/seanenck/blap/internal/logging"
 )
 
 type (
@@ -15,6 +20,19 @@ type (
 		Documentation string `json:"documentation_url"`
 	}
 
+	// RateLimit is the github api rate limit state (from response headers)
+	RateLimit struct {
+		Limit     int
+		Remaining int
+		Reset     time.Time
+	}
+
+	// RateLimitError indicates the github api rate limit is exhausted
+	RateLimitError struct {
+		RateLimit
+		Token bool
+	}
+
 	// WrapperError indicates a download error (from github specifically)
 	WrapperError struct {
 		Code   int
@@ -52,5 +70,39 @@ func (e *WrapperError) Error() string {
 		}
 	}
 	sort.Strings(msg)
-	return strings.Join(msg, "\n")
+	return logging.Redact(strings.Join(msg, "\n"))
+}
+
+// ParseRateLimit will parse rate limit headers, false if the headers are not set
+func ParseRateLimit(header http.Header) (RateLimit, bool) {
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return RateLimit{}, false
+	}
+	limit, _ := strconv.Atoi(header.Get("X-RateLimit-Limit"))
+	r := RateLimit{Limit: limit, Remaining: remaining}
+	if reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		r.Reset = time.Unix(reset, 0)
+	}
+	return r, true
+}
+
+// Exhausted indicates the rate limit has no remaining calls (until reset)
+func (r RateLimit) Exhausted() bool {
+	return r.Remaining <= 0 && time.Now().Before(r.Reset)
+}
+
+// String will display the rate limit state
+func (r RateLimit) String() string {
+	return fmt.Sprintf("%d/%d remaining, resets: %s", r.Remaining, r.Limit, r.Reset.Format(time.TimeOnly))
+}
+
+// Error is the rate limit error message
+func (e *RateLimitError) Error() string {
+	used := "no token was used, configure a token to increase the limit"
+	if e.Token {
+		used = "a token was used"
+	}
+	wait := time.Until(e.Reset).Round(time.Second)
+	return fmt.Sprintf("github rate limit exhausted (limit: %d), resets at %s (in %v), %s", e.Limit, e.Reset.Format(time.TimeOnly), max(wait, 0), used)
 }
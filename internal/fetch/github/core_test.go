@@ -2,9 +2,12 @@ package github_test
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/seanenck/blap/internal/fetch/github"
 )
@@ -57,3 +60,33 @@ func TestWrapperError(t *testing.T) {
 		t.Errorf("invalid error: %s", w.Error())
 	}
 }
+
+func TestRateLimit(t *testing.T) {
+	if _, ok := github.ParseRateLimit(http.Header{}); ok {
+		t.Error("no headers set")
+	}
+	h := http.Header{}
+	h.Set("X-RateLimit-Remaining", "0")
+	h.Set("X-RateLimit-Limit", "60")
+	h.Set("X-RateLimit-Reset", fmt.Sprintf("%d", time.Now().Add(time.Hour).Unix()))
+	r, ok := github.ParseRateLimit(h)
+	if !ok || r.Limit != 60 || r.Remaining != 0 || !r.Exhausted() {
+		t.Errorf("invalid rate limit: %v", r)
+	}
+	if !strings.HasPrefix(r.String(), "0/60 remaining, resets: ") {
+		t.Errorf("invalid string: %s", r.String())
+	}
+	err := &github.RateLimitError{RateLimit: r}
+	if !strings.HasPrefix(err.Error(), "github rate limit exhausted (limit: 60), resets at ") || !strings.HasSuffix(err.Error(), "no token was used, configure a token to increase the limit") {
+		t.Errorf("invalid error: %v", err)
+	}
+	err.Token = true
+	if !strings.HasSuffix(err.Error(), "a token was used") {
+		t.Errorf("invalid error: %v", err)
+	}
+	h.Set("X-RateLimit-Reset", fmt.Sprintf("%d", time.Now().Add(-1*time.Hour).Unix()))
+	r, _ = github.ParseRateLimit(h)
+	if r.Exhausted() {
+		t.Error("limit has reset")
+	}
+}
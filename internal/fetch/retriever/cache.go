@@ -0,0 +1,204 @@
+// Package retriever handles caching responses and lookups
+package retriever
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/seanenck/blap/internal/logging"
+	"github.com/seanenck/blap/internal/util"
+)
+
+const (
+	responseCache = "response"
+	lookupCache   = "lookup"
+	cacheExpire   = 30
+)
+
+type (
+	cachedResponse struct {
+		URL          string
+		ETag         string
+		LastModified string
+		Body         []byte
+	}
+	cachedLookup struct {
+		Key  string
+		Time time.Time
+		Data []byte
+	}
+)
+
+func (r *ResourceFetcher) cacheFile(mode, key string) string {
+	settings := r.Connections.Cache
+	if settings.Disable {
+		return ""
+	}
+	dir := settings.Directory.Expand(r.Getenv)
+	if dir == "" {
+		return ""
+	}
+	r.pruneCache(dir)
+	return filepath.Join(dir, fmt.Sprintf("%x.%s", sha256.Sum256([]byte(key)), mode))
+}
+
+// pruneCache will remove (once) cache entries that have not been written within the expiration (days)
+func (r *ResourceFetcher) pruneCache(dir string) {
+	r.cacheLock.Lock()
+	defer r.cacheLock.Unlock()
+	if r.cachePruned {
+		return
+	}
+	r.cachePruned = true
+	expire := r.Connections.Cache.Expire
+	if expire == 0 {
+		expire = cacheExpire
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	cutoff := time.Now().Add(-time.Duration(expire) * 24 * time.Hour)
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || e.IsDir() || info.ModTime().After(cutoff) {
+			continue
+		}
+		r.Debug(logging.FetchCategory, "removing expired cache entry: %s\n", e.Name())
+		os.Remove(filepath.Join(dir, e.Name()))
+	}
+}
+
+func readCache[T any](file string) (*T, error) {
+	if file == "" || !util.PathExists(file) {
+		return nil, nil
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var obj T
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return nil, nil
+	}
+	return &obj, nil
+}
+
+func writeCache(file string, obj any) error {
+	if file == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return err
+	}
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	tmp := fmt.Sprintf("%s.%d.tmp", file, os.Getpid())
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+func (r *ResourceFetcher) cachedGet(url string, fxn func(http.Header) (*http.Response, error)) (*http.Response, error) {
+	file := r.cacheFile(responseCache, url)
+	cached, err := readCache[cachedResponse](file)
+	if err != nil {
+		return nil, err
+	}
+	if r.Context.Offline {
+		if cached == nil {
+			return nil, fmt.Errorf("offline, no cached response for: %s", url)
+		}
+		r.Debug(logging.FetchCategory, "offline, using cache: %s\n", url)
+		return &http.Response{
+			StatusCode:    http.StatusOK,
+			Status:        http.StatusText(http.StatusOK),
+			Header:        http.Header{},
+			Body:          io.NopCloser(bytes.NewReader(cached.Body)),
+			ContentLength: int64(len(cached.Body)),
+		}, nil
+	}
+	header := http.Header{}
+	if cached != nil {
+		if cached.ETag != "" {
+			header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+	resp, err := fxn(header)
+	if err != nil || resp == nil || file == "" {
+		return resp, err
+	}
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		if cached == nil {
+			return resp, nil
+		}
+		r.Debug(logging.FetchCategory, "not modified, using cache: %s\n", url)
+		resp.Body.Close()
+		resp.StatusCode = http.StatusOK
+		resp.Status = http.StatusText(http.StatusOK)
+		resp.Body = io.NopCloser(bytes.NewReader(cached.Body))
+		resp.ContentLength = int64(len(cached.Body))
+		return resp, nil
+	case http.StatusOK:
+		// responses without validators are still cached (always refetched) for offline use
+		entry := cachedResponse{URL: url, ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		entry.Body = b
+		if err := writeCache(file, entry); err != nil {
+			return nil, err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(b))
+		return resp, nil
+	}
+	return resp, nil
+}
+
+// Lookup will use cached lookup data (within the configured ttl or when offline) or perform (and cache) the lookup
+func (r *ResourceFetcher) Lookup(key string, fxn func() ([]byte, error)) ([]byte, error) {
+	ttl := time.Duration(r.Connections.Cache.TTL) * time.Second
+	file := r.cacheFile(lookupCache, key)
+	cached, err := readCache[cachedLookup](file)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil && cached.Key != key {
+		cached = nil
+	}
+	if r.Context.Offline {
+		if cached == nil {
+			return nil, fmt.Errorf("offline, no cached lookup for: %s", key)
+		}
+		r.Debug(logging.FetchCategory, "offline, using cached lookup: %s\n", key)
+		return cached.Data, nil
+	}
+	if cached != nil && time.Since(cached.Time) < ttl {
+		r.Debug(logging.FetchCategory, "using cached lookup: %s\n", key)
+		return cached.Data, nil
+	}
+	b, err := fxn()
+	if err != nil {
+		return nil, err
+	}
+	if err := writeCache(file, cachedLookup{Key: key, Time: time.Now(), Data: b}); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
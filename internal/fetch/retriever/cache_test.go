@@ -0,0 +1,241 @@
+package retriever_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/seanenck/blap/internal/core"
+	"github.com/seanenck/blap/internal/fetch/retriever"
+)
+
+type cacheClient struct {
+	req    *http.Request
+	status int
+	etag   string
+	body   string
+	calls  int
+}
+
+func (m *cacheClient) Output(string, ...string) ([]byte, error) {
+	return nil, nil
+}
+
+func (m *cacheClient) Do(r *http.Request) (*http.Response, error) {
+	m.req = r
+	m.calls++
+	resp := &http.Response{StatusCode: m.status, Header: http.Header{}}
+	if m.etag != "" {
+		resp.Header.Set("ETag", m.etag)
+	}
+	resp.Body = io.NopCloser(bytes.NewBufferString(m.body))
+	return resp, nil
+}
+
+func cacheFetcher(ttl uint) (*retriever.ResourceFetcher, func()) {
+	os.RemoveAll("testdata")
+	os.Mkdir("testdata", 0o755)
+	r := &retriever.ResourceFetcher{}
+	conn := core.Connections{}
+	conn.Cache.Directory = core.Resolved(filepath.Join("testdata", "cache"))
+	conn.Cache.TTL = ttl
+	r.SetConnections(conn)
+	return r, func() {
+		os.RemoveAll("testdata")
+	}
+}
+
+func readBody(resp *http.Response) string {
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return string(b)
+}
+
+func TestCachedGet(t *testing.T) {
+	r, cleanup := cacheFetcher(0)
+	defer cleanup()
+	client := &cacheClient{status: http.StatusOK, body: "first"}
+	r.Backend = client
+	resp, err := r.Get("https://example.com/a")
+	if err != nil || readBody(resp) != "first" || client.req.Header.Get("If-None-Match") != "" {
+		t.Errorf("invalid result: %v", err)
+	}
+	client.etag = `"abc"`
+	client.body = "second"
+	resp, _ = r.Get("https://example.com/a")
+	if readBody(resp) != "second" || client.req.Header.Get("If-None-Match") != "" {
+		t.Error("invalid uncached request")
+	}
+	client.status = http.StatusNotModified
+	client.body = ""
+	resp, err = r.Get("https://example.com/a")
+	if err != nil || resp.StatusCode != http.StatusOK || readBody(resp) != "second" || client.req.Header.Get("If-None-Match") != `"abc"` {
+		t.Errorf("invalid cached result: %v %v", resp, err)
+	}
+	resp, _ = r.Get("https://example.com/b")
+	if resp.StatusCode != http.StatusNotModified || client.req.Header.Get("If-None-Match") != "" {
+		t.Error("unknown url should not be cached")
+	}
+	conn := r.Connections
+	conn.Cache.Disable = true
+	r.SetConnections(conn)
+	resp, _ = r.Get("https://example.com/a")
+	if resp.StatusCode != http.StatusNotModified || client.req.Header.Get("If-None-Match") != "" {
+		t.Error("cache is disabled")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	r, cleanup := cacheFetcher(0)
+	defer cleanup()
+	calls := 0
+	lookup := func() ([]byte, error) {
+		calls++
+		return []byte("data"), nil
+	}
+	for range 2 {
+		if b, err := r.Lookup("key", lookup); err != nil || string(b) != "data" {
+			t.Errorf("invalid lookup: %v", err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("ttl disabled, invalid calls: %d", calls)
+	}
+	r, cleanup = cacheFetcher(3600)
+	defer cleanup()
+	calls = 0
+	for range 2 {
+		if b, err := r.Lookup("key", lookup); err != nil || string(b) != "data" {
+			t.Errorf("invalid lookup: %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("invalid calls: %d", calls)
+	}
+	if b, err := r.Lookup("other", lookup); err != nil || string(b) != "data" || calls != 2 {
+		t.Errorf("invalid lookup: %v %d", err, calls)
+	}
+	if _, err := r.Lookup("error", func() ([]byte, error) {
+		return nil, errors.New("failed")
+	}); err == nil || err.Error() != "failed" {
+		t.Errorf("invalid error: %v", err)
+	}
+}
+
+func TestOffline(t *testing.T) {
+	r, cleanup := cacheFetcher(0)
+	defer cleanup()
+	client := &cacheClient{status: http.StatusOK, body: "body", etag: "1"}
+	r.Backend = client
+	readBody(func() *http.Response {
+		resp, _ := r.Get("https://example.com/a")
+		return resp
+	}())
+	client.etag = ""
+	client.body = "novalidators"
+	readBody(func() *http.Response {
+		resp, _ := r.Get("https://example.com/d")
+		return resp
+	}())
+	r.Lookup("key", func() ([]byte, error) {
+		return []byte("data"), nil
+	})
+	r.Context.Offline = true
+	client.calls = 0
+	resp, err := r.Get("https://example.com/a")
+	if err != nil || resp.StatusCode != http.StatusOK || readBody(resp) != "body" {
+		t.Errorf("invalid offline result: %v", err)
+	}
+	if resp, err := r.Get("https://example.com/d"); err != nil || readBody(resp) != "novalidators" {
+		t.Errorf("responses without validators should be cached: %v", err)
+	}
+	if _, err := r.Get("https://example.com/b"); err == nil || err.Error() != "offline, no cached response for: https://example.com/b" {
+		t.Errorf("invalid error: %v", err)
+	}
+	if b, err := r.Lookup("key", nil); err != nil || string(b) != "data" {
+		t.Errorf("invalid lookup: %v", err)
+	}
+	if _, err := r.Lookup("other", nil); err == nil || err.Error() != "offline, no cached lookup for: other" {
+		t.Errorf("invalid error: %v", err)
+	}
+	if _, err := r.ExecuteCommand("git"); err == nil || err.Error() != "offline, unable to run: git" {
+		t.Errorf("invalid error: %v", err)
+	}
+	path := filepath.Join("testdata", "archive")
+	if _, err := r.Download(true, "https://example.com/c", path); err == nil || err.Error() != "offline, archive not available: testdata/archive" {
+		t.Errorf("invalid error: %v", err)
+	}
+	os.WriteFile(path, []byte{}, 0o644)
+	if did, err := r.Download(false, "https://example.com/c", path); did || err != nil {
+		t.Errorf("invalid download: %v %v", did, err)
+	}
+	if client.calls != 0 {
+		t.Errorf("network was used: %d", client.calls)
+	}
+}
+
+func TestCacheGitHubToken(t *testing.T) {
+	r, cleanup := cacheFetcher(0)
+	defer cleanup()
+	conn := r.Connections
+	conn.GitHub.Token = "abc"
+	r.SetConnections(conn)
+	r.SetEnvironment(core.NewEnvironment(nil))
+	client := &cacheClient{status: http.StatusOK, body: "body", etag: "1"}
+	r.Backend = client
+	url := "https://api.github.com/repos/a/b/releases/latest"
+	if b := readBody(func() *http.Response {
+		resp, _ := r.Get(url)
+		return resp
+	}()); b != "body" {
+		t.Errorf("invalid body: %s", b)
+	}
+	entries, _ := os.ReadDir(filepath.Join("testdata", "cache"))
+	if len(entries) != 1 {
+		t.Fatalf("invalid cache: %v", entries)
+	}
+	info, _ := entries[0].Info()
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("invalid cache permissions: %v", info.Mode())
+	}
+	client.status = http.StatusNotModified
+	client.body = ""
+	if b := readBody(func() *http.Response {
+		resp, _ := r.Get(url)
+		return resp
+	}()); b != "body" {
+		t.Errorf("invalid body: %s", b)
+	}
+	if client.req.Header.Get("If-None-Match") != "1" || client.req.Header.Get("Authorization") != "token abc" {
+		t.Errorf("invalid headers: %v", client.req.Header)
+	}
+}
+
+func TestCacheExpire(t *testing.T) {
+	r, cleanup := cacheFetcher(0)
+	defer cleanup()
+	dir := filepath.Join("testdata", "cache")
+	os.MkdirAll(dir, 0o700)
+	old := filepath.Join(dir, "old.response")
+	current := filepath.Join(dir, "current.response")
+	os.WriteFile(old, []byte{}, 0o600)
+	os.WriteFile(current, []byte{}, 0o600)
+	past := time.Now().Add(-31 * 24 * time.Hour)
+	os.Chtimes(old, past, past)
+	r.Backend = &cacheClient{status: http.StatusOK, body: "body"}
+	readBody(func() *http.Response {
+		resp, _ := r.Get("https://example.com/a")
+		return resp
+	}())
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("expired entry should be removed: %v", err)
+	}
+	if _, err := os.Stat(current); err != nil {
+		t.Errorf("current entry should be kept: %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+// Package retriever handles the shared http client
+package retriever
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/seanenck/blap/internal/core"
+)
+
+func (r *ResourceFetcher) httpClient() (*http.Client, error) {
+	r.clientLock.Lock()
+	defer r.clientLock.Unlock()
+	if r.client != nil {
+		return r.client, nil
+	}
+	transport, err := newTransport(r.Connections.HTTP, r.Getenv)
+	if err != nil {
+		return nil, err
+	}
+	cli := &http.Client{Transport: transport, CheckRedirect: r.checkRedirect}
+	if timeout := getTimeout(r.Connections.Timeouts.Get); timeout != nil {
+		cli.Timeout = *timeout
+	}
+	r.client = cli
+	return cli, nil
+}
+
+func newTransport(settings core.HTTPSettings, getenv func(string) string) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	proxy, err := newProxy(settings, getenv)
+	if err != nil {
+		return nil, err
+	}
+	transport.Proxy = proxy
+	if len(settings.CAFiles) == 0 && settings.ClientCert == "" && settings.ClientKey == "" {
+		return transport, nil
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if len(settings.CAFiles) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, file := range settings.CAFiles {
+			path := file.Expand(getenv)
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			if !pool.AppendCertsFromPEM(b) {
+				return nil, fmt.Errorf("no certificates found in ca file: %s", path)
+			}
+		}
+		cfg.RootCAs = pool
+	}
+	if settings.ClientCert != "" || settings.ClientKey != "" {
+		if settings.ClientCert == "" || settings.ClientKey == "" {
+			return nil, errors.New("client certificate and key must both be set")
+		}
+		cert, err := tls.LoadX509KeyPair(settings.ClientCert.Expand(getenv), settings.ClientKey.Expand(getenv))
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	transport.TLSClientConfig = cfg
+	return transport, nil
+}
+
+func newProxy(settings core.HTTPSettings, getenv func(string) string) (func(*http.Request) (*url.URL, error), error) {
+	var proxy *url.URL
+	if settings.Proxy != "" {
+		u, err := url.Parse(settings.Proxy.Expand(getenv))
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy url: %s", settings.Proxy)
+		}
+		proxy = u
+	}
+	return func(req *http.Request) (*url.URL, error) {
+		if noProxy(settings.NoProxy, req.URL.Hostname()) {
+			return nil, nil
+		}
+		if proxy == nil {
+			return http.ProxyFromEnvironment(req)
+		}
+		return proxy, nil
+	}, nil
+}
+
+func noProxy(entries []string, host string) bool {
+	host = strings.ToLower(host)
+	ip := net.ParseIP(host)
+	for _, entry := range entries {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "":
+			continue
+		case entry == "*":
+			return true
+		case ip != nil:
+			if _, network, err := net.ParseCIDR(entry); err == nil && network.Contains(ip) {
+				return true
+			}
+			if other := net.ParseIP(entry); other != nil && other.Equal(ip) {
+				return true
+			}
+		default:
+			domain := strings.TrimPrefix(entry, ".")
+			if host == domain || strings.HasSuffix(host, "."+domain) {
+				return true
+			}
+		}
+	}
+	return false
+}
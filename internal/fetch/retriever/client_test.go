@@ -0,0 +1,171 @@
+package retriever_test
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/seanenck/blap/internal/core"
+	"github.com/seanenck/blap/internal/fetch/retriever"
+)
+
+func clientGet(r *retriever.ResourceFetcher, url string) (string, error) {
+	resp, err := r.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	return string(b), err
+}
+
+func TestClientCA(t *testing.T) {
+	os.RemoveAll("testdata")
+	os.Mkdir("testdata", 0o755)
+	defer os.RemoveAll("testdata")
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		io.WriteString(w, req.UserAgent())
+	}))
+	defer server.Close()
+	r := &retriever.ResourceFetcher{}
+	if _, err := clientGet(r, server.URL); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Errorf("invalid error: %v", err)
+	}
+	ca := filepath.Join("testdata", "ca.pem")
+	os.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o644)
+	conn := core.Connections{}
+	conn.HTTP.CAFiles = []core.Resolved{core.Resolved(ca)}
+	conn.HTTP.UserAgent = "blap-test"
+	r.SetConnections(conn)
+	if body, err := clientGet(r, server.URL); err != nil || body != "blap-test" {
+		t.Errorf("invalid result: %s %v", body, err)
+	}
+	invalid := filepath.Join("testdata", "invalid.pem")
+	os.WriteFile(invalid, []byte("invalid"), 0o644)
+	conn.HTTP.CAFiles = []core.Resolved{core.Resolved(invalid)}
+	r.SetConnections(conn)
+	if _, err := clientGet(r, server.URL); err == nil || err.Error() != "no certificates found in ca file: testdata/invalid.pem" {
+		t.Errorf("invalid error: %v", err)
+	}
+	conn.HTTP.CAFiles = nil
+	conn.HTTP.ClientCert = "cert"
+	r.SetConnections(conn)
+	if _, err := clientGet(r, server.URL); err == nil || err.Error() != "client certificate and key must both be set" {
+		t.Errorf("invalid error: %v", err)
+	}
+	conn.HTTP.ClientKey = "key"
+	r.SetConnections(conn)
+	if _, err := clientGet(r, server.URL); err == nil {
+		t.Error("expected key pair error")
+	}
+}
+
+func TestClientProxy(t *testing.T) {
+	os.Clearenv()
+	defer os.Clearenv()
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		io.WriteString(w, "proxy: "+req.URL.String())
+	}))
+	defer proxy.Close()
+	direct := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		io.WriteString(w, "direct")
+	}))
+	defer direct.Close()
+	r := &retriever.ResourceFetcher{}
+	conn := core.Connections{}
+	conn.HTTP.Proxy = core.Resolved(proxy.URL)
+	r.SetConnections(conn)
+	if body, err := clientGet(r, "http://upstream.example.com/a"); err != nil || body != "proxy: http://upstream.example.com/a" {
+		t.Errorf("invalid result: %s %v", body, err)
+	}
+	conn.HTTP.NoProxy = []string{".example.com", "127.0.0.0/8"}
+	r.SetConnections(conn)
+	if body, err := clientGet(r, direct.URL); err != nil || body != "direct" {
+		t.Errorf("invalid result: %s %v", body, err)
+	}
+	conn.HTTP.NoProxy = []string{"other.com"}
+	r.SetConnections(conn)
+	if body, err := clientGet(r, direct.URL+"/x"); err != nil || body != "proxy: "+direct.URL+"/x" {
+		t.Errorf("invalid result: %s %v", body, err)
+	}
+	conn.HTTP.Proxy = "invalid"
+	r.SetConnections(conn)
+	if _, err := clientGet(r, direct.URL); err == nil || err.Error() != "invalid proxy url: invalid" {
+		t.Errorf("invalid error: %v", err)
+	}
+}
+
+func TestClientPost(t *testing.T) {
+	os.Clearenv()
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		b, _ := io.ReadAll(req.Body)
+		received = append(received, req.Method+" "+req.Header.Get("Content-Type")+" "+string(b))
+		if req.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+	r := &retriever.ResourceFetcher{}
+	if err := r.Post(context.Background(), server.URL, "application/json", []byte("{}")); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if len(received) != 1 || received[0] != "POST application/json {}" {
+		t.Errorf("invalid request: %v", received)
+	}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	r.SetContext(cancelled)
+	if err := r.Post(context.Background(), server.URL, "application/json", []byte("{}")); err != nil {
+		t.Errorf("post should not use the fetcher context: %v", err)
+	}
+	if err := r.Post(context.Background(), server.URL+"/fail", "text/plain", []byte("x")); err == nil || err.Error() != "unable to post, status: 400 Bad Request" {
+		t.Errorf("invalid error: %v", err)
+	}
+}
+
+type postClient struct {
+	errs  []error
+	calls int
+}
+
+func (m *postClient) Output(string, ...string) ([]byte, error) {
+	return nil, nil
+}
+
+func (m *postClient) Do(*http.Request) (*http.Response, error) {
+	m.calls++
+	if len(m.errs) > 0 {
+		err := m.errs[0]
+		m.errs = m.errs[1:]
+		return nil, err
+	}
+	return &http.Response{StatusCode: http.StatusServiceUnavailable, Status: "503 Service Unavailable", Body: io.NopCloser(strings.NewReader(""))}, nil
+}
+
+func TestClientPostRetry(t *testing.T) {
+	r := &retriever.ResourceFetcher{}
+	conn := core.Connections{}
+	conn.Retry.Attempts = 3
+	conn.Retry.Backoff = 1
+	r.SetConnections(conn)
+	client := &postClient{errs: []error{&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, &net.DNSError{Err: "no such host", Name: "x"}}}
+	r.Backend = client
+	if err := r.Post(context.Background(), "https://example.com", "application/json", []byte("{}")); err == nil || err.Error() != "unable to post, status: 503 Service Unavailable" || client.calls != 3 {
+		t.Errorf("invalid result: %v %d", err, client.calls)
+	}
+	client = &postClient{errs: []error{io.ErrUnexpectedEOF}}
+	r.Backend = client
+	if err := r.Post(context.Background(), "https://example.com", "application/json", []byte("{}")); err == nil || !errors.Is(err, io.ErrUnexpectedEOF) || client.calls != 1 {
+		t.Errorf("sent posts should not retry: %v %d", err, client.calls)
+	}
+}
@@ -2,15 +2,21 @@
 package retriever
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"iter"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/seanenck/blap/internal/cli"
@@ -28,10 +34,22 @@ import (
 type (
 	// ResourceFetcher is the default fetcher for resources
 	ResourceFetcher struct {
-		Context     cli.Settings
-		Backend     fetch.Backend
-		Connections core.Connections
-		gitHubToken string
+		Context      cli.Settings
+		Backend      fetch.Backend
+		Connections  core.Connections
+		tokenLock    sync.Mutex
+		gitHubToken  *string
+		ctx          context.Context
+		env          *core.Environment
+		rateLock     sync.Mutex
+		rateLimit    *github.RateLimit
+		clientLock   sync.Mutex
+		client       *http.Client
+		cacheLock    sync.Mutex
+		cachePruned  bool
+		credLock     sync.Mutex
+		credTokens   map[string]string
+		netrcEntries map[string]netrcEntry
 	}
 )
 
@@ -40,6 +58,10 @@ func (r *ResourceFetcher) Process(ctx fetch.Context, sources iter.Seq[any]) (*co
 	if ctx.Name == "" {
 		return nil, errors.New("name is required")
 	}
+	if ctx.Environment == nil {
+		env := r.environment()
+		ctx.Environment = &env
+	}
 	var src any
 	for obj := range sources {
 		if !util.IsNil(obj) {
@@ -87,14 +109,21 @@ func (r *ResourceFetcher) GitHubFetch(ownerRepo, call string, to any) error {
 		return errors.New("result object must be set")
 	}
 	url := fmt.Sprintf("https://api.github.com/repos/%s/%s", ownerRepo, call)
+	if err := r.waitRateLimit(); err != nil {
+		return err
+	}
 	resp, err := r.Get(url)
 	if err != nil {
 		return err
 	}
 
 	defer resp.Body.Close()
+	limited := r.updateRateLimit(resp.Header)
 
 	if resp.StatusCode != http.StatusOK {
+		if limited != nil && limited.Remaining <= 0 && (resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests) {
+			return r.rateLimitError(*limited)
+		}
 		body, err := io.ReadAll(resp.Body)
 		if err != nil {
 			return err
@@ -114,71 +143,216 @@ func (r *ResourceFetcher) GitHubFetch(ownerRepo, call string, to any) error {
 	return json.Unmarshal(body, to)
 }
 
-// Download will download an asset
-func (r *ResourceFetcher) Download(dryrun bool, url, dest string) (bool, error) {
-	if url == "" || dest == "" {
-		return false, errors.New("source (url) and destination (path) required")
+func (r *ResourceFetcher) updateRateLimit(header http.Header) *github.RateLimit {
+	limit, ok := github.ParseRateLimit(header)
+	if !ok {
+		return nil
+	}
+	r.Debug(logging.GitHubCategory, "rate limit: %s\n", limit)
+	r.rateLock.Lock()
+	defer r.rateLock.Unlock()
+	r.rateLimit = &limit
+	return &limit
+}
+
+func (r *ResourceFetcher) rateLimitError(limit github.RateLimit) error {
+	r.tokenLock.Lock()
+	defer r.tokenLock.Unlock()
+	return &github.RateLimitError{RateLimit: limit, Token: r.gitHubToken != nil && *r.gitHubToken != ""}
+}
+
+func (r *ResourceFetcher) waitRateLimit() error {
+	r.rateLock.Lock()
+	defer r.rateLock.Unlock()
+	if r.rateLimit == nil || !r.rateLimit.Exhausted() {
+		return nil
+	}
+	wait := time.Until(r.rateLimit.Reset)
+	if wait > time.Duration(r.Connections.GitHub.Pause)*time.Second {
+		return r.rateLimitError(*r.rateLimit)
 	}
-	did := false
-	if !util.PathExists(dest) {
-		if dryrun {
-			return true, nil
+	r.Debug(logging.GitHubCategory, "rate limit exhausted, pausing: %v\n", wait.Round(time.Second))
+	select {
+	case <-r.context().Done():
+		return r.context().Err()
+	case <-time.After(wait):
+	}
+	r.rateLimit = nil
+	return nil
+}
+
+// Get performs a simple URL 'GET' (using conditional requests when cached)
+func (r *ResourceFetcher) Get(url string) (*http.Response, error) {
+	return r.cachedGet(url, func(header http.Header) (*http.Response, error) {
+		var resp *http.Response
+		err := r.retry(url, func() (bool, time.Duration, error) {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			var err error
+			resp, err = r.get(url, header)
+			if err != nil {
+				return true, 0, err
+			}
+			if again, wait := r.retryResponse(resp); again {
+				return true, wait, fmt.Errorf("status: %s", resp.Status)
+			}
+			return false, 0, nil
+		})
+		if resp != nil {
+			return resp, nil
 		}
-		r.Debug(logging.FetchCategory, "downloading asset: %s\n", url)
-		resp, err := r.Get(url)
+		return nil, err
+	})
+}
+
+// Post will send (POST) a body to a URL (using the given context, not the fetcher's), any non-2xx status is an error
+func (r *ResourceFetcher) Post(ctx context.Context, url, contentType string, body []byte) error {
+	return r.retryContext(ctx, url, func() (bool, time.Duration, error) {
+		header := http.Header{}
+		header.Set("Content-Type", contentType)
+		resp, err := r.request(ctx, "POST", url, header, body)
 		if err != nil {
-			return false, err
+			return unsent(err), 0, err
 		}
 		defer resp.Body.Close()
-		b, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return false, err
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return false, 0, fmt.Errorf("unable to post, status: %s", resp.Status)
 		}
-		if err := os.WriteFile(dest, b, 0o644); err != nil {
-			return false, err
-		}
-		did = true
-	}
-	return did, nil
+		return false, 0, nil
+	})
+}
+
+// unsent indicates a request failed before any data was sent (dns, connection refused), posts are only retried then
+func unsent(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) || errors.Is(err, syscall.ECONNREFUSED)
+}
+
+func (r *ResourceFetcher) get(url string, header http.Header) (*http.Response, error) {
+	return r.request(r.context(), "GET", url, header, nil)
 }
 
-// Get performs a simple URL 'GET'
-func (r ResourceFetcher) Get(url string) (*http.Response, error) {
-	req, err := http.NewRequest("GET", url, nil)
+func (r *ResourceFetcher) request(ctx context.Context, method, url string, header http.Header, body []byte) (*http.Response, error) {
+	return r.send(ctx, method, url, header, body, false)
+}
+
+// stream will get a (streamed) response without the client (get) timeout, the context bounds the transfer
+func (r *ResourceFetcher) stream(ctx context.Context, url string, header http.Header) (*http.Response, error) {
+	return r.send(ctx, "GET", url, header, nil, true)
+}
+
+func (r *ResourceFetcher) send(ctx context.Context, method, url string, header http.Header, body []byte, stream bool) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
 	if err != nil {
 		return nil, err
 	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if agent := r.Connections.HTTP.UserAgent; agent != "" {
+		req.Header.Set("User-Agent", agent)
+	}
 	if err := r.tokenHeader(req); err != nil {
 		return nil, err
 	}
-	return func() (*http.Response, error) {
-		if r.Backend == nil {
-			cli := &http.Client{}
-			if timeout := getTimeout(r.Connections.Timeouts.Get); timeout != nil {
-				cli.Timeout = *timeout
-			}
-			return cli.Do(req)
-		}
+	if err := r.credentialHeader(req); err != nil {
+		return nil, err
+	}
+	if r.Backend != nil {
 		return r.Backend.Do(req)
-	}()
+	}
+	cli, err := r.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	if stream {
+		streaming := *cli
+		streaming.Timeout = 0
+		return streaming.Do(req)
+	}
+	return cli.Do(req)
+}
+
+func (r *ResourceFetcher) retryResponse(resp *http.Response) (bool, time.Duration) {
+	if resp == nil || !r.Connections.Retry.Retryable(resp.StatusCode) {
+		return false, 0
+	}
+	return true, retryAfter(resp.Header.Get("Retry-After"))
+}
+
+func retryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
+
+// retry will run an attempt (which indicates if it can be retried and any requested wait) using the retry policy,
+// the final attempt result is always returned
+func (r *ResourceFetcher) retry(target string, attempt func() (bool, time.Duration, error)) error {
+	return r.retryContext(r.context(), target, attempt)
+}
+
+func (r *ResourceFetcher) retryContext(ctx context.Context, target string, attempt func() (bool, time.Duration, error)) error {
+	policy := r.Connections.Retry
+	attempts := max(policy.Attempts, 1)
+	for count := uint(1); ; count++ {
+		again, wait, err := attempt()
+		if !again || count >= attempts || ctx.Err() != nil {
+			return err
+		}
+		if wait == 0 {
+			wait = policy.Wait(count)
+		}
+		r.Debug(logging.FetchCategory, "retrying (%d/%d) in %v: %s (error: %v)\n", count+1, attempts, wait, target, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
 }
 
 func (r *ResourceFetcher) tokenHeader(req *http.Request) error {
 	if req.URL.Scheme == "https" && req.Host == "api.github.com" {
-		if r.gitHubToken == "" {
-			t, err := r.Context.ParseToken(r.Connections.GitHub)
-			if err != nil {
-				return err
-			}
-			r.gitHubToken = t
+		token, err := r.githubToken()
+		if err != nil {
+			return err
 		}
-		if r.gitHubToken != "" {
-			req.Header.Set("Authorization", fmt.Sprintf("token %s", r.gitHubToken))
+		if token != "" {
+			req.Header.Set("Authorization", fmt.Sprintf("token %s", token))
 		}
 	}
 	return nil
 }
 
+func (r *ResourceFetcher) githubToken() (string, error) {
+	r.tokenLock.Lock()
+	defer r.tokenLock.Unlock()
+	if r.gitHubToken != nil {
+		return *r.gitHubToken, nil
+	}
+	t, err := r.Context.ParseToken(r.Connections.GitHub, r.environment())
+	if err != nil {
+		return "", err
+	}
+	logging.AddSecret(t)
+	r.gitHubToken = &t
+	return t, nil
+}
+
 // Debug prints a debug message
 func (r *ResourceFetcher) Debug(cat logging.Category, msg string, args ...any) {
 	r.Context.LogDebug(cat, msg, args...)
@@ -187,22 +361,115 @@ func (r *ResourceFetcher) Debug(cat logging.Category, msg string, args ...any) {
 // SetConnections will configure connection information for the fetcher
 func (r *ResourceFetcher) SetConnections(conn core.Connections) {
 	r.Connections = conn
+	r.clientLock.Lock()
+	r.client = nil
+	r.clientLock.Unlock()
+	r.credLock.Lock()
+	r.credTokens = nil
+	r.netrcEntries = nil
+	r.credLock.Unlock()
+	r.tokenLock.Lock()
+	r.gitHubToken = nil
+	r.tokenLock.Unlock()
+	r.cacheLock.Lock()
+	r.cachePruned = false
+	r.cacheLock.Unlock()
+}
+
+// SetContext will set the context used to cancel requests and commands
+func (r *ResourceFetcher) SetContext(ctx context.Context) {
+	r.ctx = ctx
+}
+
+// SetEnvironment will set the (configuration-wide) environment used for commands and setting expansion
+func (r *ResourceFetcher) SetEnvironment(env core.Environment) {
+	r.env = &env
+}
+
+// Getenv will get an environment variable (from the set environment or the process environment)
+func (r *ResourceFetcher) Getenv(key string) string {
+	return r.environment().Getenv(key)
+}
+
+func (r *ResourceFetcher) environment() core.Environment {
+	if r.env == nil {
+		return core.NewEnvironment(os.Environ())
+	}
+	return *r.env
+}
+
+func (r *ResourceFetcher) context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// transientMarkers are (lowercase) command error/stderr fragments that indicate network failures
+var transientMarkers = []string{
+	"could not resolve",
+	"temporary failure",
+	"timed out",
+	"connection refused",
+	"connection reset",
+	"network is unreachable",
+	"remote end hung up",
+	"early eof",
+	"rpc failed",
+	"returned error: 5",
+	"returned error: 429",
+}
+
+// transientCommand indicates a command failure is (likely) a transient network failure that can be retried
+func transientCommand(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var execErr *exec.Error
+	if errors.As(err, &execErr) {
+		return false
+	}
+	text := err.Error()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		text = fmt.Sprintf("%s %s", text, exitErr.Stderr)
+	}
+	text = strings.ToLower(text)
+	for _, m := range transientMarkers {
+		if strings.Contains(text, m) {
+			return true
+		}
+	}
+	return false
 }
 
 // ExecuteCommand executes an executable and args
 func (r *ResourceFetcher) ExecuteCommand(cmd string, args ...string) (string, error) {
-	out, err := func() ([]byte, error) {
-		if r.Backend == nil {
-			command := exec.Command(cmd, args...)
-			if timeout := getTimeout(r.Connections.Timeouts.Command); timeout != nil {
-				ctx, cancel := context.WithTimeout(context.Background(), *timeout)
-				defer cancel()
-				command = exec.CommandContext(ctx, cmd, args...)
+	if r.Context.Offline {
+		return "", fmt.Errorf("offline, unable to run: %s", cmd)
+	}
+	var out []byte
+	err := r.retry(cmd, func() (bool, time.Duration, error) {
+		var err error
+		timedOut := false
+		out, err = func() ([]byte, error) {
+			if r.Backend == nil {
+				ctx := r.context()
+				if timeout := getTimeout(r.Connections.Timeouts.Command); timeout != nil {
+					var cancel context.CancelFunc
+					ctx, cancel = context.WithTimeout(ctx, *timeout)
+					defer cancel()
+				}
+				c := exec.CommandContext(ctx, cmd, args...)
+				c.Env = r.environment().Environ(false)
+				b, err := c.Output()
+				timedOut = errors.Is(ctx.Err(), context.DeadlineExceeded)
+				return b, err
 			}
-			return command.Output()
-		}
-		return r.Backend.Output(cmd, args...)
-	}()
+			return r.Backend.Output(cmd, args...)
+		}()
+		return err != nil && (timedOut || transientCommand(err)), 0, err
+	})
 	if err != nil {
 		return "", err
 	}
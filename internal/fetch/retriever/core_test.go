@@ -2,17 +2,23 @@ package retriever_test
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"iter"
 	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/seanenck/blap/internal/core"
 	"github.com/seanenck/blap/internal/fetch"
+	"github.com/seanenck/blap/internal/fetch/github"
 	"github.com/seanenck/blap/internal/fetch/retriever"
 	"github.com/seanenck/blap/internal/logging"
 )
@@ -237,3 +243,256 @@ func TestExecuteCommand(t *testing.T) {
 		t.Errorf("invalid result: %s", string(o))
 	}
 }
+
+func TestSetEnvironment(t *testing.T) {
+	t.Setenv("BLAP_ENV_TEST", "process")
+	r := &retriever.ResourceFetcher{}
+	if v := r.Getenv("BLAP_ENV_TEST"); v != "process" {
+		t.Errorf("invalid env: %s", v)
+	}
+	r.SetEnvironment(core.NewEnvironment(os.Environ()).With(core.Variables{{Key: "BLAP_ENV_TEST", Value: "global"}}))
+	if v := r.Getenv("BLAP_ENV_TEST"); v != "global" {
+		t.Errorf("invalid env: %s", v)
+	}
+	if out, err := r.ExecuteCommand("/bin/sh", "-c", "echo $BLAP_ENV_TEST"); err != nil || strings.TrimSpace(out) != "global" {
+		t.Errorf("invalid result: %s %v", out, err)
+	}
+	rsrc, err := r.Process(fetch.Context{Name: "env"}, (core.Application{Static: &core.StaticMode{URL: `https://{{ $.Getenv "BLAP_ENV_TEST" }}/a.tar.gz`, Tag: "1"}}).Items())
+	if err != nil || rsrc.URL != "https://global/a.tar.gz" {
+		t.Errorf("invalid resource: %v %v", rsrc, err)
+	}
+	if os.Getenv("BLAP_ENV_TEST") != "process" {
+		t.Error("process environment changed")
+	}
+}
+
+func TestSetContext(t *testing.T) {
+	r := &retriever.ResourceFetcher{}
+	client := &mockClient{}
+	client.payload = []byte("abc")
+	r.Backend = client
+	if _, err := r.Get("https://example.com"); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if client.req.Context().Err() != nil {
+		t.Error("context should not be done")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.SetContext(ctx)
+	cancel()
+	if _, err := r.Get("https://example.com"); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if client.req.Context().Err() == nil {
+		t.Error("context should be done")
+	}
+}
+
+type retryClient struct {
+	statuses []int
+	calls    int
+	header   string
+}
+
+func (m *retryClient) next() int {
+	idx := min(m.calls, len(m.statuses)-1)
+	m.calls++
+	return m.statuses[idx]
+}
+
+func (m *retryClient) Output(string, ...string) ([]byte, error) {
+	switch m.next() {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("repository not found: %d", m.calls)
+	default:
+		return nil, fmt.Errorf("could not resolve host: %d", m.calls)
+	}
+	return []byte("output"), nil
+}
+
+func (m *retryClient) Do(r *http.Request) (*http.Response, error) {
+	code := m.next()
+	if code == 0 {
+		return nil, fmt.Errorf("dropped: %d", m.calls)
+	}
+	resp := &http.Response{StatusCode: code, Status: fmt.Sprintf("%d", code), Header: http.Header{}}
+	resp.Header.Set("Retry-After", m.header)
+	resp.Body = io.NopCloser(bytes.NewBufferString(fmt.Sprintf("body%d", m.calls)))
+	return resp, nil
+}
+
+func TestRetry(t *testing.T) {
+	r := &retriever.ResourceFetcher{}
+	client := &retryClient{statuses: []int{503, 0, 200}}
+	r.Backend = client
+	resp, err := r.Get("a")
+	if err != nil || resp.StatusCode != 503 || client.calls != 1 {
+		t.Errorf("invalid result: %v %v %d", resp, err, client.calls)
+	}
+	conn := core.Connections{}
+	conn.Retry.Attempts = 3
+	conn.Retry.Backoff = 1
+	r.SetConnections(conn)
+	client.calls = 0
+	resp, err = r.Get("a")
+	if err != nil || resp.StatusCode != 200 || client.calls != 3 {
+		t.Errorf("invalid result: %v %v %d", resp, err, client.calls)
+	}
+	client.statuses = []int{0}
+	client.calls = 0
+	if _, err := r.Get("a"); err == nil || err.Error() != "dropped: 3" || client.calls != 3 {
+		t.Errorf("invalid error: %v %d", err, client.calls)
+	}
+	client.statuses = []int{404, 200}
+	client.calls = 0
+	resp, err = r.Get("a")
+	if err != nil || resp.StatusCode != 404 || client.calls != 1 {
+		t.Errorf("invalid result: %v %v %d", resp, err, client.calls)
+	}
+	conn.Retry.Statuses = []int{404}
+	r.SetConnections(conn)
+	client.calls = 0
+	client.header = "0"
+	resp, err = r.Get("a")
+	if err != nil || resp.StatusCode != 200 || client.calls != 2 {
+		t.Errorf("invalid result: %v %v %d", resp, err, client.calls)
+	}
+	client.statuses = []int{500, 500, 500}
+	client.calls = 0
+	resp, err = r.Get("a")
+	if err != nil || resp.StatusCode != 500 || client.calls != 1 {
+		t.Errorf("invalid result: %v %v %d", resp, err, client.calls)
+	}
+}
+
+func TestRetryDownloadCommand(t *testing.T) {
+	os.RemoveAll("testdata")
+	os.Mkdir("testdata", 0o755)
+	defer os.RemoveAll("testdata")
+	r := &retriever.ResourceFetcher{}
+	client := &retryClient{statuses: []int{502, 0, 200}}
+	r.Backend = client
+	conn := core.Connections{}
+	conn.Retry.Attempts = 3
+	conn.Retry.Backoff = 1
+	r.SetConnections(conn)
+	path := filepath.Join("testdata", "file")
+	if did, err := r.Download(false, "a", path); !did || err != nil || client.calls != 3 {
+		t.Errorf("invalid result: %v %v %d", did, err, client.calls)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "body3" {
+		t.Errorf("invalid download: %s", string(b))
+	}
+	client.statuses = []int{500, 500, 200}
+	client.calls = 0
+	if out, err := r.ExecuteCommand("git"); err != nil || out != "output" || client.calls != 3 {
+		t.Errorf("invalid result: %s %v %d", out, err, client.calls)
+	}
+	client.calls = 0
+	conn.Retry.Attempts = 2
+	r.SetConnections(conn)
+	if _, err := r.ExecuteCommand("git"); err == nil || err.Error() != "could not resolve host: 2" {
+		t.Errorf("invalid error: %v", err)
+	}
+	client.statuses = []int{404, 200}
+	client.calls = 0
+	if _, err := r.ExecuteCommand("git"); err == nil || err.Error() != "repository not found: 1" || client.calls != 1 {
+		t.Errorf("deterministic failures should not retry: %v %d", err, client.calls)
+	}
+	r.Backend = nil
+	if _, err := r.ExecuteCommand("blap-missing-command"); err == nil || !errors.Is(err, exec.ErrNotFound) {
+		t.Errorf("invalid error: %v", err)
+	}
+}
+
+type rateClient struct {
+	calls     int
+	remaining string
+	reset     time.Time
+	status    int
+}
+
+func (m *rateClient) Output(string, ...string) ([]byte, error) {
+	return nil, nil
+}
+
+func (m *rateClient) Do(r *http.Request) (*http.Response, error) {
+	m.calls++
+	resp := &http.Response{StatusCode: m.status, Header: http.Header{}}
+	resp.Header.Set("X-RateLimit-Remaining", m.remaining)
+	resp.Header.Set("X-RateLimit-Limit", "60")
+	resp.Header.Set("X-RateLimit-Reset", fmt.Sprintf("%d", m.reset.Unix()))
+	resp.Body = io.NopCloser(bytes.NewBufferString("{}"))
+	return resp, nil
+}
+
+func TestGitHubRateLimit(t *testing.T) {
+	r := &retriever.ResourceFetcher{}
+	client := &rateClient{remaining: "1", status: http.StatusOK, reset: time.Now().Add(time.Hour)}
+	r.Backend = client
+	if err := r.GitHubFetch("a/b", "releases", &struct{}{}); err != nil || client.calls != 1 {
+		t.Errorf("invalid result: %v %d", err, client.calls)
+	}
+	client.remaining = "0"
+	client.status = http.StatusForbidden
+	var limit *github.RateLimitError
+	if err := r.GitHubFetch("a/b", "releases", &struct{}{}); !errors.As(err, &limit) || limit.Token || client.calls != 2 {
+		t.Errorf("invalid error: %v %d", err, client.calls)
+	}
+	if err := r.GitHubFetch("a/b", "releases", &struct{}{}); !errors.As(err, &limit) || client.calls != 2 {
+		t.Errorf("should fail fast: %v %d", err, client.calls)
+	}
+	conn := core.Connections{}
+	conn.GitHub.Pause = 7200
+	r.SetConnections(conn)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r.SetContext(ctx)
+	if err := r.GitHubFetch("a/b", "releases", &struct{}{}); !errors.Is(err, context.Canceled) || client.calls != 2 {
+		t.Errorf("should pause: %v %d", err, client.calls)
+	}
+}
+
+type tokenClient struct {
+	lock    sync.Mutex
+	headers []string
+}
+
+func (m *tokenClient) Output(string, ...string) ([]byte, error) {
+	return nil, nil
+}
+
+func (m *tokenClient) Do(r *http.Request) (*http.Response, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.headers = append(m.headers, r.Header.Get("Authorization"))
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("{}"))}, nil
+}
+
+func TestGitHubTokenConcurrent(t *testing.T) {
+	client := &tokenClient{}
+	r := &retriever.ResourceFetcher{Backend: client}
+	conn := core.Connections{}
+	conn.GitHub.Token = "abc"
+	r.SetConnections(conn)
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if resp, err := r.Get("https://api.github.com/repos/abc/xyz"); err == nil {
+				resp.Body.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(client.headers) != 10 {
+		t.Errorf("invalid requests: %v", client.headers)
+	}
+	for _, h := range client.headers {
+		if h != "token abc" {
+			t.Errorf("invalid header: %s", h)
+		}
+	}
+}
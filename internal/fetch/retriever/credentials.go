@@ -0,0 +1,188 @@
+// Package retriever handles per-host credentials (and netrc)
+package retriever
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/seanenck/blap/internal/core"
+	"github.com/seanenck/blap/internal/logging"
+)
+
+const (
+	authHeader   = "Authorization"
+	netrcDefault = ""
+)
+
+type netrcEntry struct {
+	login    string
+	password string
+}
+
+func (r *ResourceFetcher) credentialHeader(req *http.Request) error {
+	host, cred, ok := r.credential(req)
+	if !ok {
+		login, ok, err := r.netrc(req)
+		if err != nil {
+			return err
+		}
+		if ok && req.Header.Get(authHeader) == "" {
+			req.SetBasicAuth(login.login, login.password)
+		}
+		return nil
+	}
+	if cred.Type != core.HeaderCredential && req.Header.Get(authHeader) != "" {
+		return nil
+	}
+	token, err := r.credentialToken(host, cred)
+	if err != nil {
+		return err
+	}
+	if token == "" {
+		return nil
+	}
+	switch cred.Type {
+	case core.BasicCredential:
+		req.SetBasicAuth(cred.User, token)
+	case core.HeaderCredential:
+		req.Header.Set(cred.Header, token)
+	default:
+		req.Header.Set(authHeader, fmt.Sprintf("Bearer %s", token))
+	}
+	return nil
+}
+
+func (r *ResourceFetcher) credential(req *http.Request) (string, core.Credential, bool) {
+	for _, host := range []string{req.URL.Host, req.URL.Hostname()} {
+		if cred, ok := r.Connections.Credentials[host]; ok {
+			return host, cred, true
+		}
+	}
+	return "", core.Credential{}, false
+}
+
+func (r *ResourceFetcher) credentialToken(host string, cred core.Credential) (string, error) {
+	r.credLock.Lock()
+	defer r.credLock.Unlock()
+	if token, ok := r.credTokens[host]; ok {
+		return token, nil
+	}
+	token, err := r.Context.ParseToken(cred, r.environment())
+	if err != nil {
+		return "", err
+	}
+	logging.AddSecret(token)
+	if r.credTokens == nil {
+		r.credTokens = make(map[string]string)
+	}
+	r.credTokens[host] = token
+	return token, nil
+}
+
+func (r *ResourceFetcher) netrc(req *http.Request) (netrcEntry, bool, error) {
+	path := r.Connections.Netrc.Expand(r.Getenv)
+	if path == "" {
+		return netrcEntry{}, false, nil
+	}
+	r.credLock.Lock()
+	defer r.credLock.Unlock()
+	if r.netrcEntries == nil {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				return netrcEntry{}, false, err
+			}
+			r.Debug(logging.FetchCategory, "netrc not found: %s\n", path)
+		}
+		r.netrcEntries = parseNetrc(b)
+		for _, entry := range r.netrcEntries {
+			logging.AddSecret(entry.password)
+		}
+	}
+	for _, machine := range []string{req.URL.Hostname(), netrcDefault} {
+		if entry, ok := r.netrcEntries[machine]; ok {
+			return entry, true, nil
+		}
+	}
+	return netrcEntry{}, false, nil
+}
+
+func parseNetrc(data []byte) map[string]netrcEntry {
+	entries := make(map[string]netrcEntry)
+	var machine string
+	var entry netrcEntry
+	defined := false
+	commit := func() {
+		if defined {
+			if _, ok := entries[machine]; !ok {
+				entries[machine] = entry
+			}
+		}
+		defined = false
+		entry = netrcEntry{}
+	}
+	inMacro := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if inMacro {
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+		fields := strings.Fields(line)
+		for idx := 0; idx < len(fields); idx++ {
+			next := func() string {
+				if idx+1 >= len(fields) {
+					return ""
+				}
+				idx++
+				return fields[idx]
+			}
+			switch field := fields[idx]; field {
+			case "machine", "default":
+				commit()
+				defined = true
+				machine = netrcDefault
+				if field == "machine" {
+					machine = next()
+				}
+			case "login":
+				entry.login = next()
+			case "password":
+				entry.password = next()
+			case "account":
+				next()
+			case "macdef":
+				commit()
+				inMacro = true
+				idx = len(fields)
+			default:
+				if strings.HasPrefix(field, "#") {
+					idx = len(fields)
+				}
+			}
+		}
+	}
+	commit()
+	return entries
+}
+
+func (r *ResourceFetcher) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	if req.URL.Host == via[0].URL.Host {
+		return nil
+	}
+	for _, cred := range r.Connections.Credentials {
+		if cred.Type == core.HeaderCredential {
+			req.Header.Del(cred.Header)
+		}
+	}
+	return nil
+}
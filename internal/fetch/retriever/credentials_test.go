@@ -0,0 +1,140 @@
+package retriever_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/seanenck/blap/internal/core"
+	"github.com/seanenck/blap/internal/fetch/retriever"
+)
+
+func credentialRequest(t *testing.T, r *retriever.ResourceFetcher, client *mockClient, url string) *http.Request {
+	client.req = nil
+	if _, err := r.Get(url); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	return client.req
+}
+
+func TestCredentials(t *testing.T) {
+	os.Clearenv()
+	defer os.Clearenv()
+	os.RemoveAll("testdata")
+	os.Mkdir("testdata", 0o755)
+	defer os.RemoveAll("testdata")
+	script := filepath.Join("testdata", "token.sh")
+	os.WriteFile(script, []byte("#!/bin/sh\necho '  key  '"), 0o755)
+	client := &mockClient{payload: []byte("abc")}
+	r := &retriever.ResourceFetcher{Backend: client}
+	conn := core.Connections{}
+	conn.Credentials = map[string]core.Credential{
+		"bearer.local":      {Token: "xyz"},
+		"basic.local":       {Type: core.BasicCredential, User: "user", Token: "pass"},
+		"header.local:8080": {Type: core.HeaderCredential, Header: "X-Api-Key", Command: []core.Resolved{core.Resolved(script)}},
+		"empty.local":       {},
+	}
+	r.SetConnections(conn)
+	if req := credentialRequest(t, r, client, "https://bearer.local/a"); req.Header.Get("Authorization") != "Bearer xyz" {
+		t.Errorf("invalid header: %v", req.Header)
+	}
+	req := credentialRequest(t, r, client, "https://basic.local/a")
+	if user, pass, ok := req.BasicAuth(); !ok || user != "user" || pass != "pass" {
+		t.Errorf("invalid basic auth: %v", req.Header)
+	}
+	if req := credentialRequest(t, r, client, "https://header.local:8080/a"); req.Header.Get("X-Api-Key") != "key" || req.Header.Get("Authorization") != "" {
+		t.Errorf("invalid header: %v", req.Header)
+	}
+	if req := credentialRequest(t, r, client, "https://header.local/a"); req.Header.Get("X-Api-Key") != "" {
+		t.Errorf("invalid header: %v", req.Header)
+	}
+	if req := credentialRequest(t, r, client, "https://empty.local/a"); len(req.Header) != 0 {
+		t.Errorf("invalid header: %v", req.Header)
+	}
+	if req := credentialRequest(t, r, client, "https://other.local/a"); len(req.Header) != 0 {
+		t.Errorf("invalid header: %v", req.Header)
+	}
+	conn.Credentials = map[string]core.Credential{"fail.local": {Command: []core.Resolved{"/invalid/command"}}}
+	r.SetConnections(conn)
+	if _, err := r.Get("https://fail.local/a"); err == nil {
+		t.Error("expected command error")
+	}
+}
+
+func TestNetrc(t *testing.T) {
+	os.Clearenv()
+	defer os.Clearenv()
+	os.RemoveAll("testdata")
+	os.Mkdir("testdata", 0o755)
+	defer os.RemoveAll("testdata")
+	netrc := filepath.Join("testdata", "netrc")
+	os.WriteFile(netrc, []byte(`# comment
+machine netrc.local login user password pass
+machine other.local
+  login other
+  account x
+  password secret # trailing
+macdef init
+  cd /pub
+
+default login anon password guest
+`), 0o644)
+	client := &mockClient{payload: []byte("abc")}
+	r := &retriever.ResourceFetcher{Backend: client}
+	conn := core.Connections{}
+	conn.Netrc = core.Resolved(filepath.Join("testdata", "missing"))
+	r.SetConnections(conn)
+	if req := credentialRequest(t, r, client, "https://netrc.local/a"); len(req.Header) != 0 {
+		t.Errorf("invalid header: %v", req.Header)
+	}
+	conn.Netrc = core.Resolved(netrc)
+	conn.Credentials = map[string]core.Credential{"explicit.local": {Token: "xyz"}}
+	r.SetConnections(conn)
+	for url, expect := range map[string][]string{
+		"https://netrc.local/a":   {"user", "pass"},
+		"https://other.local:9/a": {"other", "secret"},
+		"https://unknown.local/a": {"anon", "guest"},
+	} {
+		req := credentialRequest(t, r, client, url)
+		if user, pass, ok := req.BasicAuth(); !ok || user != expect[0] || pass != expect[1] {
+			t.Errorf("invalid basic auth: %s %v", url, req.Header)
+		}
+	}
+	if req := credentialRequest(t, r, client, "https://explicit.local/a"); req.Header.Get("Authorization") != "Bearer xyz" {
+		t.Errorf("invalid header: %v", req.Header)
+	}
+}
+
+func TestCredentialRedirect(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		io.WriteString(w, req.Header.Get("X-Api-Key"))
+	}))
+	defer target.Close()
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/same" {
+			io.WriteString(w, req.Header.Get("X-Api-Key"))
+			return
+		}
+		if req.URL.Path == "/local" {
+			http.Redirect(w, req, "/same", http.StatusFound)
+			return
+		}
+		http.Redirect(w, req, target.URL, http.StatusFound)
+	}))
+	defer origin.Close()
+	r := &retriever.ResourceFetcher{}
+	conn := core.Connections{}
+	conn.Credentials = map[string]core.Credential{
+		origin.Listener.Addr().String(): {Type: core.HeaderCredential, Header: "X-Api-Key", Token: "key"},
+	}
+	r.SetConnections(conn)
+	if body, err := clientGet(r, origin.URL+"/local"); err != nil || body != "key" {
+		t.Errorf("invalid result: %s %v", body, err)
+	}
+	if body, err := clientGet(r, origin.URL+"/remote"); err != nil || body != "" {
+		t.Errorf("invalid result: %s %v", body, err)
+	}
+}
@@ -0,0 +1,227 @@
+// Package retriever handles (streaming) asset downloads
+package retriever
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/seanenck/blap/internal/cli"
+	"github.com/seanenck/blap/internal/logging"
+	"github.com/seanenck/blap/internal/util"
+)
+
+const (
+	partialSuffix  = ".partial"
+	progressWidth  = 20
+	progressUpdate = 250 * time.Millisecond
+)
+
+type progress struct {
+	settings cli.Settings
+	id       string
+	name     string
+	total    int64
+	current  int64
+	last     time.Time
+}
+
+// Download will download an asset (resuming any partial download), mirrors (and rewritten urls) are tried before the url
+func (r *ResourceFetcher) Download(dryrun bool, url, dest string, mirrors ...string) (bool, error) {
+	if url == "" || dest == "" {
+		return false, errors.New("source (url) and destination (path) required")
+	}
+	if util.PathExists(dest) {
+		return false, nil
+	}
+	if r.Context.Offline {
+		return false, fmt.Errorf("offline, archive not available: %s", dest)
+	}
+	if dryrun {
+		return true, nil
+	}
+	partial := dest + partialSuffix
+	var errs []error
+	sources := r.sources(url, mirrors)
+	for idx, source := range sources {
+		if idx > 0 {
+			if err := os.Remove(partial); err != nil && !os.IsNotExist(err) {
+				return false, err
+			}
+		}
+		r.Debug(logging.FetchCategory, "downloading asset: %s\n", source)
+		err := r.retry(source, func() (bool, time.Duration, error) {
+			return r.download(source, partial)
+		})
+		if err == nil {
+			if err := os.Rename(partial, dest); err != nil {
+				return false, err
+			}
+			return true, nil
+		}
+		if len(sources) > 1 {
+			err = fmt.Errorf("%s: %w", source, err)
+		}
+		errs = append(errs, err)
+		if r.context().Err() != nil {
+			break
+		}
+		r.Context.LogCore(logging.FetchCategory, "download failed: %v\n", err)
+	}
+	return false, errors.Join(errs...)
+}
+
+func (r *ResourceFetcher) sources(url string, mirrors []string) []string {
+	var res []string
+	add := func(source string) {
+		if source != "" && !slices.Contains(res, source) {
+			res = append(res, source)
+		}
+	}
+	for _, m := range mirrors {
+		add(r.Connections.Rewrite(m, r.Getenv))
+	}
+	add(r.Connections.Rewrite(url, r.Getenv))
+	add(url)
+	return res
+}
+
+func (r *ResourceFetcher) download(url, partial string) (bool, time.Duration, error) {
+	var offset int64
+	if info, err := os.Stat(partial); err == nil {
+		offset = info.Size()
+	}
+	header := http.Header{}
+	if offset > 0 {
+		r.Debug(logging.FetchCategory, "resuming download at %d bytes: %s\n", offset, url)
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	// downloads are streamed, the (get) client timeout does not apply to the transfer
+	ctx := r.context()
+	if timeout := getTimeout(r.Connections.Timeouts.Download); timeout != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	resp, err := r.stream(ctx, url, header)
+	if err != nil {
+		return true, 0, err
+	}
+	defer resp.Body.Close()
+	restart := func(reason string) (bool, time.Duration, error) {
+		if err := os.Remove(partial); err != nil && !os.IsNotExist(err) {
+			return false, 0, err
+		}
+		r.Debug(logging.FetchCategory, "%s, restarting: %s\n", reason, url)
+		return r.download(url, partial)
+	}
+	flags := os.O_CREATE | os.O_WRONLY
+	total := int64(-1)
+	switch resp.StatusCode {
+	case http.StatusOK:
+		offset = 0
+		flags |= os.O_TRUNC
+	case http.StatusPartialContent:
+		start, size, ok := contentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			if offset == 0 {
+				return false, 0, fmt.Errorf("invalid content range: %s", resp.Header.Get("Content-Range"))
+			}
+			return restart("unexpected content range")
+		}
+		total = size
+		if offset == 0 {
+			flags |= os.O_TRUNC
+		} else {
+			flags |= os.O_APPEND
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		if _, size, ok := contentRange(resp.Header.Get("Content-Range")); ok && size == offset {
+			r.Debug(logging.FetchCategory, "download already complete: %s\n", url)
+			return false, 0, nil
+		}
+		return restart("unable to resume download")
+	default:
+		again, wait := r.retryResponse(resp)
+		return again, wait, fmt.Errorf("unable to download, status: %s", resp.Status)
+	}
+	f, err := os.OpenFile(partial, flags, 0o644)
+	if err != nil {
+		return false, 0, err
+	}
+	defer f.Close()
+	if total < 0 && resp.ContentLength > 0 {
+		total = offset + resp.ContentLength
+	}
+	p := &progress{settings: r.Context, id: partial, name: strings.TrimSuffix(filepath.Base(partial), partialSuffix), total: total, current: offset}
+	written, err := io.Copy(io.MultiWriter(f, p), resp.Body)
+	p.render(true)
+	if err != nil {
+		return true, 0, err
+	}
+	if resp.ContentLength > 0 && written != resp.ContentLength {
+		return true, 0, fmt.Errorf("incomplete download, expected %d bytes, received: %d", resp.ContentLength, written)
+	}
+	return false, 0, nil
+}
+
+// contentRange parses a 'bytes <start>-<end>/<total>' (or 'bytes */<total>') header, total is -1 when unknown
+func contentRange(value string) (int64, int64, bool) {
+	spec, ok := strings.CutPrefix(strings.TrimSpace(value), "bytes ")
+	if !ok {
+		return 0, 0, false
+	}
+	span, size, ok := strings.Cut(spec, "/")
+	if !ok {
+		return 0, 0, false
+	}
+	total := int64(-1)
+	if size != "*" {
+		n, err := strconv.ParseInt(size, 10, 64)
+		if err != nil {
+			return 0, 0, false
+		}
+		total = n
+	}
+	if span == "*" {
+		return -1, total, total >= 0
+	}
+	first, _, ok := strings.Cut(span, "-")
+	if !ok {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return start, total, true
+}
+
+func (p *progress) Write(b []byte) (int, error) {
+	p.current += int64(len(b))
+	if time.Since(p.last) >= progressUpdate {
+		p.render(false)
+	}
+	return len(b), nil
+}
+
+func (p *progress) render(done bool) {
+	p.last = time.Now()
+	size := fmt.Sprintf("%.1f MiB", float64(p.current)/(1024*1024))
+	if p.total <= 0 {
+		p.settings.LogProgress(logging.FetchCategory, p.id, done, "%s %s", p.name, size)
+		return
+	}
+	percent := min(p.current*100/p.total, 100)
+	filled := int(percent) * progressWidth / 100
+	bar := strings.Repeat("#", filled) + strings.Repeat("-", progressWidth-filled)
+	p.settings.LogProgress(logging.FetchCategory, p.id, done, "%s [%s] %3d%% %s/%.1f MiB", p.name, bar, percent, size, float64(p.total)/(1024*1024))
+}
@@ -0,0 +1,240 @@
+package retriever_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/seanenck/blap/internal/core"
+	"github.com/seanenck/blap/internal/fetch/retriever"
+)
+
+type rangeClient struct {
+	payload []byte
+	short   int
+	status  int
+	ranges  []string
+	urls    []string
+	failing []string
+	shift   int
+}
+
+func (m *rangeClient) Output(string, ...string) ([]byte, error) {
+	return nil, nil
+}
+
+func (m *rangeClient) Do(r *http.Request) (*http.Response, error) {
+	resp := &http.Response{}
+	header := r.Header.Get("Range")
+	m.ranges = append(m.ranges, header)
+	m.urls = append(m.urls, r.URL.String())
+	if m.status != 0 || slices.Contains(m.failing, r.URL.Host) {
+		resp.StatusCode = max(m.status, http.StatusNotFound)
+		resp.Status = fmt.Sprintf("%d", resp.StatusCode)
+		resp.Body = io.NopCloser(bytes.NewBuffer(nil))
+		return resp, nil
+	}
+	data := m.payload
+	resp.StatusCode = http.StatusOK
+	if header != "" {
+		offset, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(header, "bytes="), "-"))
+		if err != nil {
+			return nil, err
+		}
+		resp.Header = http.Header{}
+		if offset >= len(data) {
+			resp.StatusCode = http.StatusRequestedRangeNotSatisfiable
+			resp.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", len(data)))
+			resp.Body = io.NopCloser(bytes.NewBuffer(nil))
+			return resp, nil
+		}
+		offset -= m.shift
+		m.shift = 0
+		resp.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, len(data)-1, len(data)))
+		data = data[offset:]
+		resp.StatusCode = http.StatusPartialContent
+	}
+	resp.ContentLength = int64(len(data))
+	if m.short > 0 {
+		data = data[:len(data)-m.short]
+		m.short = 0
+	}
+	resp.Body = io.NopCloser(bytes.NewBuffer(data))
+	return resp, nil
+}
+
+func TestDownloadResume(t *testing.T) {
+	os.RemoveAll("testdata")
+	os.Mkdir("testdata", 0o755)
+	defer os.RemoveAll("testdata")
+	client := &rangeClient{payload: []byte("abcdef")}
+	r := &retriever.ResourceFetcher{Backend: client}
+	path := filepath.Join("testdata", "file")
+	os.WriteFile(path+".partial", []byte("abc"), 0o644)
+	if did, err := r.Download(false, "a", path); !did || err != nil {
+		t.Errorf("invalid result: %v %v", did, err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "abcdef" {
+		t.Errorf("invalid download: %s", string(b))
+	}
+	if _, err := os.Stat(path + ".partial"); !os.IsNotExist(err) {
+		t.Errorf("partial should be removed: %v", err)
+	}
+	if fmt.Sprintf("%v", client.ranges) != "[bytes=3-]" {
+		t.Errorf("invalid ranges: %v", client.ranges)
+	}
+	os.Remove(path)
+	client.ranges = nil
+	os.WriteFile(path+".partial", []byte("abcdefg"), 0o644)
+	if did, err := r.Download(false, "a", path); !did || err != nil {
+		t.Errorf("invalid result: %v %v", did, err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "abcdef" {
+		t.Errorf("invalid download: %s", string(b))
+	}
+	if fmt.Sprintf("%v", client.ranges) != "[bytes=7- ]" {
+		t.Errorf("invalid ranges: %v", client.ranges)
+	}
+	os.Remove(path)
+	client.ranges = nil
+	os.WriteFile(path+".partial", []byte("abcdef"), 0o644)
+	if did, err := r.Download(false, "a", path); !did || err != nil {
+		t.Errorf("invalid result: %v %v", did, err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "abcdef" {
+		t.Errorf("invalid download: %s", string(b))
+	}
+	if fmt.Sprintf("%v", client.ranges) != "[bytes=6-]" {
+		t.Errorf("complete partial should not restart: %v", client.ranges)
+	}
+	os.Remove(path)
+	client.ranges = nil
+	client.shift = 1
+	os.WriteFile(path+".partial", []byte("abc"), 0o644)
+	if did, err := r.Download(false, "a", path); !did || err != nil {
+		t.Errorf("invalid result: %v %v", did, err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "abcdef" {
+		t.Errorf("misaligned range should restart: %s", string(b))
+	}
+	if fmt.Sprintf("%v", client.ranges) != "[bytes=3- ]" {
+		t.Errorf("invalid ranges: %v", client.ranges)
+	}
+}
+
+func TestDownloadTimeout(t *testing.T) {
+	os.RemoveAll("testdata")
+	os.Mkdir("testdata", 0o755)
+	defer os.RemoveAll("testdata")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Length", "6")
+		w.Write([]byte("abc"))
+		w.(http.Flusher).Flush()
+		time.Sleep(1500 * time.Millisecond)
+		w.Write([]byte("def"))
+	}))
+	defer server.Close()
+	r := &retriever.ResourceFetcher{}
+	conn := core.Connections{}
+	conn.Timeouts.Get = 1
+	r.SetConnections(conn)
+	path := filepath.Join("testdata", "file")
+	if did, err := r.Download(false, server.URL, path); !did || err != nil {
+		t.Errorf("get timeout should not apply to downloads: %v %v", did, err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "abcdef" {
+		t.Errorf("invalid download: %s", string(b))
+	}
+}
+
+func TestDownloadIncomplete(t *testing.T) {
+	os.RemoveAll("testdata")
+	os.Mkdir("testdata", 0o755)
+	defer os.RemoveAll("testdata")
+	client := &rangeClient{payload: []byte("abcdef"), short: 2}
+	r := &retriever.ResourceFetcher{Backend: client}
+	conn := core.Connections{}
+	conn.Retry.Attempts = 2
+	conn.Retry.Backoff = 1
+	r.SetConnections(conn)
+	path := filepath.Join("testdata", "file")
+	if did, err := r.Download(false, "a", path); !did || err != nil {
+		t.Errorf("invalid result: %v %v", did, err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "abcdef" {
+		t.Errorf("invalid download: %s", string(b))
+	}
+	if fmt.Sprintf("%v", client.ranges) != "[ bytes=4-]" {
+		t.Errorf("invalid ranges: %v", client.ranges)
+	}
+	os.Remove(path)
+	client.short = 2
+	conn.Retry.Attempts = 1
+	r.SetConnections(conn)
+	if _, err := r.Download(false, "a", path); err == nil || err.Error() != "incomplete download, expected 6 bytes, received: 4" {
+		t.Errorf("invalid error: %v", err)
+	}
+	if b, _ := os.ReadFile(path + ".partial"); string(b) != "abcd" {
+		t.Errorf("invalid partial: %s", string(b))
+	}
+}
+
+func TestDownloadStatus(t *testing.T) {
+	os.RemoveAll("testdata")
+	os.Mkdir("testdata", 0o755)
+	defer os.RemoveAll("testdata")
+	client := &rangeClient{status: http.StatusNotFound}
+	r := &retriever.ResourceFetcher{Backend: client}
+	path := filepath.Join("testdata", "file")
+	if _, err := r.Download(false, "a", path); err == nil || err.Error() != "unable to download, status: 404" {
+		t.Errorf("invalid error: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("file should not exist: %v", err)
+	}
+}
+
+func TestDownloadMirrors(t *testing.T) {
+	os.RemoveAll("testdata")
+	os.Mkdir("testdata", 0o755)
+	defer os.RemoveAll("testdata")
+	client := &rangeClient{payload: []byte("abcdef"), failing: []string{"mirror", "cache"}}
+	r := &retriever.ResourceFetcher{Backend: client}
+	conn := core.Connections{}
+	conn.Rewrites = map[string]core.Resolved{"https://upstream/": "https://cache/up/"}
+	r.SetConnections(conn)
+	path := filepath.Join("testdata", "file")
+	if did, err := r.Download(false, "https://upstream/a", path, "https://mirror/a", "https://upstream/a", ""); !did || err != nil {
+		t.Errorf("invalid result: %v %v", did, err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "abcdef" {
+		t.Errorf("invalid download: %s", string(b))
+	}
+	if fmt.Sprintf("%v", client.urls) != "[https://mirror/a https://cache/up/a https://upstream/a]" {
+		t.Errorf("invalid urls: %v", client.urls)
+	}
+	os.Remove(path)
+	client.urls = nil
+	client.failing = []string{"upstream"}
+	if did, err := r.Download(false, "https://upstream/a", path); !did || err != nil {
+		t.Errorf("invalid result: %v %v", did, err)
+	}
+	if fmt.Sprintf("%v", client.urls) != "[https://cache/up/a]" {
+		t.Errorf("invalid urls: %v", client.urls)
+	}
+	os.Remove(path)
+	client.urls = nil
+	client.failing = []string{"mirror", "cache", "upstream"}
+	if _, err := r.Download(false, "https://upstream/a", path, "https://mirror/a"); err == nil || err.Error() != "https://mirror/a: unable to download, status: 404\nhttps://cache/up/a: unable to download, status: 404\nhttps://upstream/a: unable to download, status: 404" {
+		t.Errorf("invalid error: %v", err)
+	}
+}
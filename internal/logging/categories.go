@@ -1,6 +1,12 @@
 // Package logging handles log helper
 package logging
 
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
 // Category are logging category definitions
 type Category string
 
@@ -24,3 +30,30 @@ const (
 	// GitHubCategory are for github-based logging needs
 	GitHubCategory = "github"
 )
+
+// Categories are all known logging categories
+func Categories() []Category {
+	return []Category{BuildCategory, FetchCategory, ConfigCategory, SelfCategory, IndexCategory, ProcessCategory, ExtractCategory, FilteringCategory, GitHubCategory}
+}
+
+// ParseCategories will parse (and validate) category names (values may be comma-separated)
+func ParseCategories(values ...string) ([]Category, error) {
+	var res []Category
+	known := Categories()
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			cat := Category(name)
+			if !slices.Contains(known, cat) {
+				return nil, fmt.Errorf("unknown log category: %s", name)
+			}
+			if !slices.Contains(res, cat) {
+				res = append(res, cat)
+			}
+		}
+	}
+	return res, nil
+}
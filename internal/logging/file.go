@@ -1,14 +1,31 @@
 package logging
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
 	"time"
+)
 
-	"github.com/seanenck/blap/internal/util"
+const (
+	// TextFormat is the (default) 'timestamp - message' log format
+	TextFormat = "text"
+	// JSONFormat writes one json object per log event
+	JSONFormat = "json"
 )
 
+// Event is a (structured) log event
+type Event struct {
+	Timestamp string   `json:"timestamp"`
+	Category  Category `json:"category"`
+	App       string   `json:"app,omitempty"`
+	Action    string   `json:"action,omitempty"`
+	Tag       string   `json:"tag,omitempty"`
+	Error     string   `json:"error,omitempty"`
+	Message   string   `json:"message"`
+}
+
 // Append handles simple log writing
 func Append(logFile, msg string, parts ...any) error {
 	if logFile != "" {
@@ -17,7 +34,7 @@ func Append(logFile, msg string, parts ...any) error {
 			return err
 		}
 		defer f.Close()
-		m := fmt.Sprintf(msg, parts...)
+		m := Redact(fmt.Sprintf(msg, parts...))
 		m = strings.TrimSpace(m)
 		m = fmt.Sprintf("%s - %s\n", time.Now().Format("2006-01-02T15:04:05"), m)
 		if _, err := fmt.Fprint(f, m); err != nil {
@@ -27,35 +44,38 @@ func Append(logFile, msg string, parts ...any) error {
 	return nil
 }
 
-// Rotate handles a very simple log rotation
-func Rotate(logFile string, inSize int64, callback func()) error {
-	if logFile != "" && util.PathExists(logFile) {
-		info, err := os.Stat(logFile)
-		if err != nil {
-			return err
-		}
-		size := inSize
-		switch {
-		case size == 0:
-			size = 10
-		case size > 0:
-		case size < 0:
-			return fmt.Errorf("invalid log roll size, < 0 (have: %d)", size)
-		}
-		if info.Size() > size*1024*1024 {
-			callback()
-			old := fmt.Sprintf("%s.old", logFile)
-			r, err := os.ReadFile(logFile)
-			if err != nil {
-				return err
-			}
-			if err := os.WriteFile(old, r, 0o644); err != nil {
-				return err
-			}
-			if err := os.Remove(logFile); err != nil {
-				return err
-			}
-		}
+// AppendEvent handles writing an event to the log (in the given format)
+func AppendEvent(logFile, format string, event Event) error {
+	if logFile == "" {
+		return nil
 	}
-	return nil
+	if err := CheckFormat(format); err != nil {
+		return err
+	}
+	if format != JSONFormat {
+		return Append(logFile, "%s", event.Message)
+	}
+	event.Timestamp = time.Now().Format(time.RFC3339)
+	event.Message = strings.TrimSpace(Redact(event.Message))
+	event.Error = Redact(event.Error)
+	b, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "%s\n", b)
+	return err
+}
+
+// CheckFormat will validate a log format
+func CheckFormat(format string) error {
+	switch format {
+	case "", TextFormat, JSONFormat:
+		return nil
+	}
+	return fmt.Errorf("unknown log format: %s", format)
 }
@@ -1,6 +1,7 @@
 package logging_test
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"strings"
@@ -59,22 +60,22 @@ func TestAppendTo(t *testing.T) {
 
 func TestRotate(t *testing.T) {
 	defer setupTeardown()()
-	if err := logging.Rotate("", -1, func() {}); err != nil {
+	if err := logging.Rotate("", logging.Rotation{Size: -1}, func() {}); err != nil {
 		t.Errorf("invalid error: %v", err)
 	}
 	log := filepath.Join("testdata", "log")
-	if err := logging.Rotate(log, -1, func() {}); err != nil {
+	if err := logging.Rotate(log, logging.Rotation{Size: -1}, func() {}); err != nil {
 		t.Errorf("invalid error: %v", err)
 	}
 	os.WriteFile(log, []byte{}, 0o644)
-	if err := logging.Rotate(log, -1, func() {}); err == nil || err.Error() != "invalid log roll size, < 0 (have: -1)" {
+	if err := logging.Rotate(log, logging.Rotation{Size: -1}, func() {}); err == nil || err.Error() != "invalid log roll size, < 0 (have: -1)" {
 		t.Errorf("invalid error: %v", err)
 	}
 	rotated := false
 	rotate := func() {
 		rotated = true
 	}
-	if err := logging.Rotate(log, 0, rotate); err != nil {
+	if err := logging.Rotate(log, logging.Rotation{}, rotate); err != nil {
 		t.Errorf("invalid error: %v", err)
 	}
 	if rotated {
@@ -91,14 +92,48 @@ func TestRotate(t *testing.T) {
 		i++
 	}
 	os.WriteFile(log, buf, 0o644)
-	if err := logging.Rotate(log, 1, rotate); err != nil {
+	if err := logging.Rotate(log, logging.Rotation{Size: 1}, rotate); err != nil {
 		t.Errorf("invalid error: %v", err)
 	}
 	if !rotated {
 		t.Error("should have rotated")
 	}
 	files, _ = os.ReadDir("testdata")
-	if len(files) != 1 || files[0].Name() != "log.old" {
+	if len(files) != 1 || files[0].Name() != "log.1" {
 		t.Errorf("invalid dir: %v", files)
 	}
 }
+
+func TestAppendEvent(t *testing.T) {
+	defer setupTeardown()()
+	if err := logging.AppendEvent("", "xml", logging.Event{}); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	log := filepath.Join("testdata", "log")
+	if err := logging.AppendEvent(log, "xml", logging.Event{}); err == nil || err.Error() != "unknown log format: xml" {
+		t.Errorf("invalid error: %v", err)
+	}
+	if err := logging.AppendEvent(log, "", logging.Event{Message: "text message\n"}); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	logging.AddSecret("event-secret")
+	event := logging.Event{Category: logging.ProcessCategory, App: "a", Action: "commit", Tag: "v1", Error: "bad event-secret", Message: "commit: a\n"}
+	if err := logging.AppendEvent(log, logging.JSONFormat, event); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	d, _ := os.ReadFile(log)
+	lines := strings.Split(strings.TrimSpace(string(d)), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], " - text message") {
+		t.Errorf("invalid data: %v", lines)
+	}
+	var read logging.Event
+	if err := json.Unmarshal([]byte(lines[1]), &read); err != nil {
+		t.Errorf("invalid json: %v", err)
+	}
+	if read.Timestamp == "" || read.Category != logging.ProcessCategory || read.App != "a" || read.Action != "commit" || read.Tag != "v1" || read.Error != "bad [redacted]" || read.Message != "commit: a" {
+		t.Errorf("invalid event: %v", read)
+	}
+	if strings.Contains(lines[1], "event-secret") {
+		t.Errorf("secret not redacted: %s", lines[1])
+	}
+}
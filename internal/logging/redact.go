@@ -0,0 +1,56 @@
+package logging
+
+import (
+	"slices"
+	"strings"
+	"sync"
+)
+
+const (
+	// Redacted is the replacement for secret values in outputs
+	Redacted = "[redacted]"
+	// minSecret avoids masking (very) short, common values
+	minSecret = 4
+)
+
+var redaction = struct {
+	sync.RWMutex
+	secrets  []string
+	replacer *strings.Replacer
+}{}
+
+// AddSecret will register (resolved) secret values to redact from logs and errors
+func AddSecret(values ...string) {
+	redaction.Lock()
+	defer redaction.Unlock()
+	changed := false
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if len(v) < minSecret || slices.Contains(redaction.secrets, v) {
+			continue
+		}
+		redaction.secrets = append(redaction.secrets, v)
+		changed = true
+	}
+	if !changed {
+		return
+	}
+	slices.SortFunc(redaction.secrets, func(a, b string) int {
+		return len(b) - len(a)
+	})
+	var pairs []string
+	for _, s := range redaction.secrets {
+		pairs = append(pairs, s, Redacted)
+	}
+	redaction.replacer = strings.NewReplacer(pairs...)
+}
+
+// Redact will mask any registered secret values
+func Redact(in string) string {
+	redaction.RLock()
+	defer redaction.RUnlock()
+	if redaction.replacer == nil {
+		return in
+	}
+	return redaction.replacer.Replace(in)
+}
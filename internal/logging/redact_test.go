@@ -0,0 +1,37 @@
+package logging_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/seanenck/blap/internal/logging"
+)
+
+func TestRedact(t *testing.T) {
+	if s := logging.Redact("nothing-secret-here"); s != "nothing-secret-here" {
+		t.Errorf("invalid redact: %s", s)
+	}
+	logging.AddSecret("", "abc", "  token-a  ", "token-a-long")
+	if s := logging.Redact("x abc token-a token-a-long y"); s != "x abc [redacted] [redacted] y" {
+		t.Errorf("invalid redact: %s", s)
+	}
+	logging.AddSecret("token-a")
+	if s := logging.Redact("token-atoken-a"); s != "[redacted][redacted]" {
+		t.Errorf("invalid redact: %s", s)
+	}
+}
+
+func TestAppendRedact(t *testing.T) {
+	defer setupTeardown()()
+	logging.AddSecret("append-secret")
+	log := filepath.Join("testdata", "log")
+	if err := logging.Append(log, "url: https://host/?token=%s", "append-secret"); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	d, _ := os.ReadFile(log)
+	if str := string(d); strings.Contains(str, "append-secret") || !strings.Contains(str, "token=[redacted]") {
+		t.Errorf("invalid data: %s", str)
+	}
+}
@@ -0,0 +1,160 @@
+package logging
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/seanenck/blap/internal/util"
+)
+
+const (
+	compressedExt = ".gz"
+	legacyExt     = ".old"
+	textTimestamp = "2006-01-02T15:04:05"
+)
+
+// Rotation are log rotation settings
+type Rotation struct {
+	Size     int64
+	Keep     int
+	Compress bool
+	Age      uint
+}
+
+// Rotate handles log rotation (by size or age) into numbered (optionally compressed) generations
+func Rotate(logFile string, settings Rotation, callback func()) error {
+	if logFile == "" || !util.PathExists(logFile) {
+		return nil
+	}
+	info, err := os.Stat(logFile)
+	if err != nil {
+		return err
+	}
+	size := settings.Size
+	switch {
+	case size == 0:
+		size = 10
+	case size > 0:
+	case size < 0:
+		return fmt.Errorf("invalid log roll size, < 0 (have: %d)", size)
+	}
+	keep := settings.Keep
+	switch {
+	case keep == 0:
+		keep = 1
+	case keep < 0:
+		return fmt.Errorf("invalid log generations, < 0 (have: %d)", keep)
+	}
+	rotate := info.Size() > size*1024*1024
+	if !rotate && settings.Age > 0 {
+		first, ok, err := firstEntry(logFile)
+		if err != nil {
+			return err
+		}
+		rotate = ok && time.Since(first) > time.Duration(settings.Age)*24*time.Hour
+	}
+	if !rotate {
+		return nil
+	}
+	callback()
+	if err := migrateLegacy(logFile); err != nil {
+		return err
+	}
+	for gen := keep; gen > 0; gen-- {
+		for _, ext := range []string{"", compressedExt} {
+			from := generation(logFile, gen) + ext
+			if !util.PathExists(from) {
+				continue
+			}
+			if gen == keep {
+				if err := os.Remove(from); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := os.Rename(from, generation(logFile, gen+1)+ext); err != nil {
+				return err
+			}
+		}
+	}
+	first := generation(logFile, 1)
+	if err := os.Rename(logFile, first); err != nil {
+		return err
+	}
+	if settings.Compress {
+		return compress(first)
+	}
+	return nil
+}
+
+// migrateLegacy moves a (single generation) <log>.old into the numbered generations
+func migrateLegacy(logFile string) error {
+	legacy := logFile + legacyExt
+	if !util.PathExists(legacy) {
+		return nil
+	}
+	first := generation(logFile, 1)
+	if util.PathExists(first) || util.PathExists(first+compressedExt) {
+		return os.Remove(legacy)
+	}
+	return os.Rename(legacy, first)
+}
+
+func generation(logFile string, gen int) string {
+	return fmt.Sprintf("%s.%d", logFile, gen)
+}
+
+func compress(file string) error {
+	in, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := file + compressedExt + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := gzip.NewWriter(out)
+	_, err = io.Copy(w, in)
+	err = errors.Join(err, w.Close(), out.Close())
+	if err == nil {
+		err = os.Rename(tmp, file+compressedExt)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(file)
+}
+
+func firstEntry(logFile string) (time.Time, bool, error) {
+	f, err := os.Open(logFile)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	if !scanner.Scan() {
+		return time.Time{}, false, scanner.Err()
+	}
+	line := scanner.Text()
+	var event Event
+	if strings.HasPrefix(line, "{") && json.Unmarshal([]byte(line), &event) == nil {
+		t, err := time.Parse(time.RFC3339, event.Timestamp)
+		return t, err == nil, nil
+	}
+	if len(line) < len(textTimestamp) {
+		return time.Time{}, false, nil
+	}
+	t, err := time.ParseInLocation(textTimestamp, line[:len(textTimestamp)], time.Local)
+	return t, err == nil, nil
+}
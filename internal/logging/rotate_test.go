@@ -0,0 +1,134 @@
+package logging_test
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/seanenck/blap/internal/logging"
+)
+
+func rotatedFiles() []string {
+	files, _ := os.ReadDir("testdata")
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestRotateGenerations(t *testing.T) {
+	defer setupTeardown()()
+	log := filepath.Join("testdata", "log")
+	settings := logging.Rotation{Size: 1, Keep: 2}
+	big := make([]byte, 1024*1024+1)
+	for idx := range 3 {
+		big[0] = byte(idx)
+		os.WriteFile(log, big, 0o644)
+		if err := logging.Rotate(log, settings, func() {}); err != nil {
+			t.Errorf("invalid error: %v", err)
+		}
+	}
+	if names := fmt.Sprintf("%v", rotatedFiles()); names != "[log.1 log.2]" {
+		t.Errorf("invalid files: %s", names)
+	}
+	if b, _ := os.ReadFile(log + ".1"); b[0] != 2 {
+		t.Errorf("invalid generation: %d", b[0])
+	}
+	if b, _ := os.ReadFile(log + ".2"); b[0] != 1 {
+		t.Errorf("invalid generation: %d", b[0])
+	}
+	settings.Compress = true
+	settings.Keep = 3
+	big[0] = 3
+	os.WriteFile(log, big, 0o644)
+	if err := logging.Rotate(log, settings, func() {}); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if names := fmt.Sprintf("%v", rotatedFiles()); names != "[log.1.gz log.2 log.3]" {
+		t.Errorf("invalid files: %s", names)
+	}
+	f, _ := os.Open(log + ".1.gz")
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("invalid gzip: %v", err)
+	}
+	b, _ := io.ReadAll(r)
+	if len(b) != len(big) || b[0] != 3 {
+		t.Errorf("invalid compressed data: %d", len(b))
+	}
+	settings.Keep = -1
+	if err := logging.Rotate(log+".2", settings, func() {}); err == nil || err.Error() != "invalid log generations, < 0 (have: -1)" {
+		t.Errorf("invalid error: %v", err)
+	}
+}
+
+func TestRotateLegacy(t *testing.T) {
+	defer setupTeardown()()
+	log := filepath.Join("testdata", "log")
+	settings := logging.Rotation{Size: 1, Keep: 2}
+	big := make([]byte, 1024*1024+1)
+	os.WriteFile(log+".old", []byte{1}, 0o644)
+	os.WriteFile(log, big, 0o644)
+	if err := logging.Rotate(log, settings, func() {}); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if names := fmt.Sprintf("%v", rotatedFiles()); names != "[log.1 log.2]" {
+		t.Errorf("invalid files: %s", names)
+	}
+	if b, _ := os.ReadFile(log + ".2"); len(b) != 1 || b[0] != 1 {
+		t.Errorf("invalid migrated generation: %v", b)
+	}
+	os.WriteFile(log+".old", []byte{1}, 0o644)
+	os.WriteFile(log, big, 0o644)
+	if err := logging.Rotate(log, settings, func() {}); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if names := fmt.Sprintf("%v", rotatedFiles()); names != "[log.1 log.2]" {
+		t.Errorf("invalid files: %s", names)
+	}
+	if b, _ := os.ReadFile(log + ".2"); len(b) != len(big) {
+		t.Errorf("invalid generation: %d", len(b))
+	}
+}
+
+func TestRotateAge(t *testing.T) {
+	defer setupTeardown()()
+	log := filepath.Join("testdata", "log")
+	rotated := false
+	rotate := func() {
+		rotated = true
+	}
+	settings := logging.Rotation{Age: 1}
+	old := time.Now().Add(-48 * time.Hour)
+	os.WriteFile(log, []byte(time.Now().Format("2006-01-02T15:04:05")+" - new\n"), 0o644)
+	if err := logging.Rotate(log, settings, rotate); err != nil || rotated {
+		t.Errorf("invalid rotate: %v %v", rotated, err)
+	}
+	os.WriteFile(log, []byte("invalid\n"), 0o644)
+	if err := logging.Rotate(log, settings, rotate); err != nil || rotated {
+		t.Errorf("invalid rotate: %v %v", rotated, err)
+	}
+	os.WriteFile(log, []byte(old.Format("2006-01-02T15:04:05")+" - old\n"), 0o644)
+	if err := logging.Rotate(log, logging.Rotation{}, rotate); err != nil || rotated {
+		t.Errorf("invalid rotate: %v %v", rotated, err)
+	}
+	if err := logging.Rotate(log, settings, rotate); err != nil || !rotated {
+		t.Errorf("invalid rotate: %v %v", rotated, err)
+	}
+	rotated = false
+	os.WriteFile(log, []byte(fmt.Sprintf("{\"timestamp\":\"%s\",\"category\":\"process\",\"message\":\"old\"}\n", old.Format(time.RFC3339))), 0o644)
+	if err := logging.Rotate(log, settings, rotate); err != nil || !rotated {
+		t.Errorf("invalid rotate: %v %v", rotated, err)
+	}
+	if names := fmt.Sprintf("%v", rotatedFiles()); names != "[log.1]" {
+		t.Errorf("invalid files: %s", names)
+	}
+}
@@ -10,6 +10,8 @@ import (
 	"github.com/seanenck/blap/internal/core"
 )
 
+const cacheDir = ".cache"
+
 type (
 	// Configuration is the overall configuration
 	Configuration struct {
@@ -24,14 +26,34 @@ type (
 		Include         []core.Resolved
 		Apps            core.AppSet
 		Parallelization int
+		Builds          int
 		Pinned          core.Pinned
 		Connections     core.Connections
 		Variables       core.Variables
 		Logging         struct {
+			File       core.Resolved
+			Size       int64
+			Format     string
+			Keep       int
+			Compress   bool
+			Age        uint
+			Categories []string
+		}
+		Summary struct {
+			File   core.Resolved
+			Format string
+		}
+		Metrics struct {
 			File core.Resolved
-			Size int64
 		}
+		Notify struct {
+			Webhooks []core.Resolved
+			Command  []core.Resolved
+		}
+		Hooks          Hooks
 		pinnedMatchers []*regexp.Regexp
+		enabled        map[string]struct{}
+		skipped        map[string]string
 		logFile        string
 		dir            string
 	}
@@ -0,0 +1,85 @@
+// Package processing handles global (pre/post run) hooks
+package processing
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/seanenck/blap/internal/core"
+	"github.com/seanenck/blap/internal/fetch"
+	"github.com/seanenck/blap/internal/logging"
+	"github.com/seanenck/blap/internal/steps"
+	"github.com/seanenck/blap/internal/util"
+)
+
+const hooksName = "hooks"
+
+// Hooks are command steps run once per processing run
+type Hooks struct {
+	PreUpgrade  []core.Step `toml:"pre_upgrade"`
+	PostUpgrade []core.Step `toml:"post_upgrade"`
+	PrePurge    []core.Step `toml:"pre_purge"`
+	PostPurge   []core.Step `toml:"post_purge"`
+}
+
+func (h Hooks) get(purge, post bool) []core.Step {
+	switch {
+	case purge && post:
+		return h.PostPurge
+	case purge:
+		return h.PrePurge
+	case post:
+		return h.PostUpgrade
+	}
+	return h.PreUpgrade
+}
+
+func (c Configuration) runHooks(post bool, mode string, fetcher fetch.Retriever, runner util.Runner, changed []Change) error {
+	hooks := c.Hooks.get(c.context.Purge, post)
+	if len(hooks) == 0 {
+		return nil
+	}
+	stage := "pre"
+	if post {
+		stage = "post"
+	}
+	if c.context.DryRun {
+		c.context.LogDebug(logging.ProcessCategory, "dryrun, skipping %s %s hooks\n", stage, mode)
+		return nil
+	}
+	c.context.LogDebug(logging.ProcessCategory, "running %s %s hooks\n", stage, mode)
+	var names, tags, dirs, purged []string
+	for _, change := range changed {
+		names = append(names, change.Name)
+		if c.context.Purge {
+			purged = append(purged, change.Details)
+		} else {
+			tags = append(tags, fmt.Sprintf("%s=%s", change.Name, change.Details))
+		}
+		dirs = append(dirs, filepath.Join(c.dir, change.Name))
+	}
+	vars := steps.NewVariables(fetcher)
+	vars.Directories.Root = c.dir
+	e, err := core.NewValues(hooksName, vars)
+	if err != nil {
+		return err
+	}
+	step := steps.Context{}
+	step.Variables = e
+	step.Settings = c.context
+	step.Environment = core.NewEnvironment(os.Environ()).With(c.Variables).
+		Set("BLAP_MODE", mode).
+		Set("BLAP_CHANGED", strings.Join(names, " ")).
+		Set("BLAP_CHANGED_DIRS", strings.Join(dirs, string(os.PathListSeparator)))
+	if c.context.Purge {
+		step.Environment = step.Environment.Set("BLAP_PURGED", strings.Join(purged, string(os.PathListSeparator)))
+	} else {
+		step.Environment = step.Environment.Set("BLAP_CHANGED_TAGS", strings.Join(tags, " "))
+	}
+	if err := steps.Do(hooks, runner, step, core.CommandEnv{}); err != nil {
+		return fmt.Errorf("%s %s hook failed: %w", stage, mode, err)
+	}
+	return nil
+}
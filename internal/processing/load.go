@@ -45,7 +45,26 @@ func Load(input string, context cli.Settings) (Configuration, error) {
 		return c, err
 	}
 	c.logFile = c.Logging.File.String()
+	if err := logging.CheckFormat(c.Logging.Format); err != nil {
+		return c, err
+	}
+	if err := c.context.SetLogCategories(false, c.Logging.Categories...); err != nil {
+		return c, err
+	}
+	if err := checkSummaryFormat(c.Summary.Format); err != nil {
+		return c, err
+	}
+	c.skipped = make(map[string]string)
 	c.dir = c.Directory.String()
+	if c.Connections.Cache.Directory == "" && c.dir != "" {
+		c.Connections.Cache.Directory = core.Resolved(c.NewFile(cacheDir))
+	}
+	for host, cred := range c.Connections.Credentials {
+		if err := cred.Check(); err != nil {
+			return c, fmt.Errorf("invalid credentials for %s: %w", host, err)
+		}
+	}
+	defined := make(map[string]struct{})
 	checkAddApp := func(name string, a core.Application) (bool, error) {
 		if err := a.Flags.Check(); err != nil {
 			return false, err
@@ -53,7 +72,11 @@ func Load(input string, context cli.Settings) (Configuration, error) {
 		if a.Flags.Pin() {
 			c.Pinned = append(c.Pinned, name)
 		}
-		return a.Enabled(), nil
+		ok := a.Enabled()
+		if !ok {
+			c.skipped[name] = skipReason(a.Flags)
+		}
+		return ok, nil
 	}
 	logDebug := func(msg string, args ...any) {
 		c.context.LogDebug(logging.ConfigCategory, msg, args...)
@@ -87,11 +110,15 @@ func Load(input string, context cli.Settings) (Configuration, error) {
 			if err := apps.Flags.Check(); err != nil {
 				return Configuration{}, err
 			}
+			for k := range apps.Apps {
+				defined[k] = struct{}{}
+			}
 			if apps.Flags.Skipped() {
-				if apps.Flags.Pin() {
-					for k := range apps.Apps {
+				for k := range apps.Apps {
+					if apps.Flags.Pin() {
 						c.Pinned = append(c.Pinned, k)
 					}
+					c.skipped[k] = skipReason(apps.Flags)
 				}
 				continue
 			}
@@ -113,7 +140,10 @@ func Load(input string, context cli.Settings) (Configuration, error) {
 	}
 	canFilter := context.FilterApplications()
 	sub := make(map[string]core.Application)
+	c.enabled = make(map[string]struct{})
+	enabled := make(core.AppSet)
 	for n, a := range c.Apps {
+		defined[n] = struct{}{}
 		ok, err := checkAddApp(n, a)
 		if err != nil {
 			return Configuration{}, err
@@ -121,14 +151,38 @@ func Load(input string, context cli.Settings) (Configuration, error) {
 		if !ok {
 			continue
 		}
+		c.enabled[n] = struct{}{}
+		enabled[n] = a
 		allowed := true
 		if canFilter {
 			allowed = context.AllowApplication(n)
 		}
 		if allowed {
 			sub[n] = a
+		} else {
+			c.skipped[n] = "filtered"
 		}
 	}
+	if err := checkDependencies(enabled, func(name string) bool {
+		_, ok := defined[name]
+		return ok
+	}); err != nil {
+		return Configuration{}, err
+	}
+	var unknown []string
+	for _, n := range context.ApplicationNames() {
+		if _, ok := defined[n]; !ok {
+			unknown = append(unknown, n)
+			continue
+		}
+		if _, ok := c.enabled[n]; !ok {
+			c.context.LogCore(logging.ConfigCategory, "application is not enabled: %s\n", n)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return Configuration{}, fmt.Errorf("unknown applications: %s", strings.Join(unknown, ", "))
+	}
 	var re []*regexp.Regexp
 	var knownPins []string
 	for _, p := range c.Pinned {
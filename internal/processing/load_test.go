@@ -84,3 +84,30 @@ func TestList(t *testing.T) {
 		t.Errorf("invalid buffer: %s", s)
 	}
 }
+
+func TestLoadApplicationNames(t *testing.T) {
+	makeTestFile("disabled.more.toml")
+	example := filepath.Join("examples", "config.toml")
+	s := cli.Settings{}
+	s.CompileApplicationFilters(nil, []string{"nvim", "zzz", "aaa"}, false)
+	if _, err := processing.Load(example, s); err == nil || err.Error() != "unknown applications: aaa, zzz" {
+		t.Errorf("invalid error: %v", err)
+	}
+	var buf bytes.Buffer
+	s.Writer = &buf
+	s.Verbosity = cli.InfoVerbosity
+	s.CompileApplicationFilters([]string{"^lock"}, []string{"nvim", "nvim2"}, false)
+	c, err := processing.Load(example, s)
+	if err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if len(c.Apps) != 2 {
+		t.Errorf("invalid apps: %v", c.Apps)
+	}
+	if _, ok := c.Apps["nvim"]; !ok {
+		t.Errorf("invalid apps: %v", c.Apps)
+	}
+	if s := buf.String(); !strings.Contains(s, "application is not enabled: nvim2") {
+		t.Errorf("invalid buffer: %s", s)
+	}
+}
@@ -0,0 +1,191 @@
+// Package processing handles per-application (output) logs
+package processing
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/seanenck/blap/internal/logging"
+)
+
+const (
+	logsDir     = ".logs"
+	logsKeep    = 10
+	logsTail    = 20
+	logsExt     = ".log"
+	logsPattern = "20060102T150405.000"
+)
+
+type appLog struct {
+	dir     string
+	file    string
+	f       *os.File
+	pending []byte
+}
+
+func (c Configuration) appLogs(name string) string {
+	return filepath.Join(c.dir, logsDir, name)
+}
+
+func (c Configuration) newAppLog(name string) *appLog {
+	dir := c.appLogs(name)
+	return &appLog{dir: dir, file: filepath.Join(dir, time.Now().Format(logsPattern)+logsExt)}
+}
+
+// Write will write (redacted lines) to the log, the log is only created on the first write
+func (l *appLog) Write(b []byte) (int, error) {
+	if l.f == nil {
+		if err := os.MkdirAll(l.dir, 0o755); err != nil {
+			return 0, err
+		}
+		f, err := os.Create(l.file)
+		if err != nil {
+			return 0, err
+		}
+		l.f = f
+		if err := pruneLogs(l.dir); err != nil {
+			return 0, err
+		}
+	}
+	l.pending = append(l.pending, b...)
+	idx := bytes.LastIndexByte(l.pending, '\n')
+	if idx < 0 {
+		return len(b), nil
+	}
+	if _, err := io.WriteString(l.f, logging.Redact(string(l.pending[:idx+1]))); err != nil {
+		return 0, err
+	}
+	l.pending = l.pending[idx+1:]
+	return len(b), nil
+}
+
+func (l *appLog) flush() error {
+	if l.f == nil || len(l.pending) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(l.f, logging.Redact(string(l.pending)))
+	l.pending = nil
+	return err
+}
+
+// Close will close the log (if it was created)
+func (l *appLog) Close() error {
+	if l.f == nil {
+		return nil
+	}
+	return errors.Join(l.flush(), l.f.Close())
+}
+
+// logged will reference the log in an error (for output that was also given to the console)
+func (l *appLog) logged(err error) error {
+	if l.f == nil {
+		return err
+	}
+	if flushErr := l.flush(); flushErr != nil {
+		return errors.Join(err, flushErr)
+	}
+	return fmt.Errorf("%w (log: %s)", err, l.file)
+}
+
+// failed will show the log tail (on the console) and reference the log in an error
+func (l *appLog) failed(c Configuration, name string, err error) error {
+	if l.f == nil {
+		return err
+	}
+	if flushErr := l.flush(); flushErr != nil {
+		return errors.Join(err, flushErr)
+	}
+	lines, tailErr := tailLog(l.file, logsTail)
+	if tailErr != nil {
+		return errors.Join(err, tailErr)
+	}
+	if c.context.Writer != nil && len(lines) > 0 {
+		processLock.Lock()
+		defer processLock.Unlock()
+		fmt.Fprintf(c.context.Writer, "==> %s failed, last %d line(s) of: %s\n", name, len(lines), l.file)
+		fmt.Fprintln(c.context.Writer, strings.Join(lines, "\n"))
+	}
+	return fmt.Errorf("%w (log: %s)", err, l.file)
+}
+
+func listLogs(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var logs []string
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), logsExt) {
+			continue
+		}
+		logs = append(logs, filepath.Join(dir, e.Name()))
+	}
+	slices.Sort(logs)
+	return logs, nil
+}
+
+func pruneLogs(dir string) error {
+	logs, err := listLogs(dir)
+	if err != nil {
+		return err
+	}
+	for len(logs) > logsKeep {
+		if err := os.Remove(logs[0]); err != nil {
+			return err
+		}
+		logs = logs[1:]
+	}
+	return nil
+}
+
+func tailLog(file string, count int) ([]string, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.TrimRight(string(b), "\n"), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return nil, nil
+	}
+	if len(lines) > count {
+		lines = lines[len(lines)-count:]
+	}
+	return lines, nil
+}
+
+// Logs will write the latest (output) log for an application
+func (c Configuration) Logs(w io.Writer, name string) error {
+	if w == nil {
+		return errors.New("nil writer")
+	}
+	if name == "" {
+		return errors.New("name is required")
+	}
+	if c.dir == "" {
+		return errors.New("directory is required")
+	}
+	logs, err := listLogs(c.appLogs(name))
+	if err != nil {
+		return err
+	}
+	if len(logs) == 0 {
+		return fmt.Errorf("no logs found for application: %s", name)
+	}
+	f, err := os.Open(logs[len(logs)-1])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
@@ -0,0 +1,55 @@
+package processing_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/seanenck/blap/internal/cli"
+	"github.com/seanenck/blap/internal/processing"
+)
+
+func TestLogs(t *testing.T) {
+	defer os.RemoveAll(filepath.Join("testdata", ".logs"))
+	cfg, _ := processing.Load(filepath.Join("examples", "config.toml"), cli.Settings{})
+	if err := cfg.Logs(nil, "a"); err == nil || err.Error() != "nil writer" {
+		t.Errorf("invalid error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := cfg.Logs(&buf, ""); err == nil || err.Error() != "name is required" {
+		t.Errorf("invalid error: %v", err)
+	}
+	if err := cfg.Logs(&buf, "a"); err == nil || err.Error() != "no logs found for application: a" {
+		t.Errorf("invalid error: %v", err)
+	}
+	dir := filepath.Join("testdata", ".logs", "a")
+	os.MkdirAll(dir, 0o755)
+	os.WriteFile(filepath.Join(dir, "20240101T000000.000.log"), []byte("old"), 0o644)
+	os.WriteFile(filepath.Join(dir, "20250101T000000.000.log"), []byte("new"), 0o644)
+	os.WriteFile(filepath.Join(dir, "20260101T000000.000.txt"), []byte("other"), 0o644)
+	if err := cfg.Logs(&buf, "a"); err != nil || buf.String() != "new" {
+		t.Errorf("invalid logs: %s %v", buf.String(), err)
+	}
+}
+
+func TestLogsDirectory(t *testing.T) {
+	os.Mkdir("testdata", 0o755)
+	to := filepath.Join("testdata", "config.toml")
+	defer os.Remove(to)
+	os.WriteFile(to, []byte("[apps.abc.static]\nurl = \"https://example.com/abc.tar.gz\"\ntag = \"1\"\n"), 0o644)
+	cfg, err := processing.Load(to, cli.Settings{})
+	if err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if err := cfg.Logs(&bytes.Buffer{}, "abc"); err == nil || err.Error() != "directory is required" {
+		t.Errorf("invalid error: %v", err)
+	}
+	m := &mockExecutor{}
+	if err := cfg.Do(processing.Context{Executor: m, Name: "abc", Fetcher: m, Runner: m}); err == nil || err.Error() != "directory is required" {
+		t.Errorf("invalid error: %v", err)
+	}
+	if _, err := os.Stat("abc"); !os.IsNotExist(err) {
+		t.Errorf("nothing should be written without a directory: %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+// Package processing handles prometheus (textfile) metrics
+package processing
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/seanenck/blap/internal/logging"
+	"github.com/seanenck/blap/internal/util"
+)
+
+const failuresMetric = "blap_run_failures_total"
+
+var labelEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+
+func metricLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func previousFailures(file string) float64 {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		value, ok := strings.CutPrefix(scanner.Text(), failuresMetric+" ")
+		if !ok {
+			continue
+		}
+		if v, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+			return v
+		}
+	}
+	return 0
+}
+
+func (s *runSummary) metrics(report Summary, failures float64, dryrun bool) []byte {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var buf bytes.Buffer
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+	var apps []string
+	for name := range s.tags {
+		apps = append(apps, name)
+	}
+	for name := range s.installed {
+		if _, ok := s.tags[name]; !ok {
+			apps = append(apps, name)
+		}
+	}
+	slices.Sort(apps)
+	metric("blap_app_installed_info", "gauge", "Installed (deployed) application tag.")
+	for _, name := range apps {
+		if tag := s.installed[name]; tag != "" {
+			fmt.Fprintf(&buf, "blap_app_installed_info{app=\"%s\",tag=\"%s\"} 1\n", metricLabel(name), metricLabel(tag))
+		}
+	}
+	metric("blap_app_update_available", "gauge", "Whether the resolved application tag is not deployed.")
+	for _, name := range apps {
+		tag, ok := s.tags[name]
+		if !ok {
+			continue
+		}
+		available := 0
+		if tag != s.installed[name] {
+			available = 1
+		}
+		fmt.Fprintf(&buf, "blap_app_update_available{app=\"%s\"} %d\n", metricLabel(name), available)
+	}
+	var timed []string
+	for name := range s.durations {
+		timed = append(timed, name)
+	}
+	slices.Sort(timed)
+	metric("blap_app_duration_seconds", "gauge", "Time spent processing an application in the last run.")
+	for _, name := range timed {
+		fmt.Fprintf(&buf, "blap_app_duration_seconds{app=\"%s\"} %g\n", metricLabel(name), s.durations[name].Seconds())
+	}
+	metric("blap_app_failed", "gauge", "Whether an application failed in the last run.")
+	for _, name := range timed {
+		failed := 0
+		if _, ok := s.failed[name]; ok {
+			failed = 1
+		}
+		fmt.Fprintf(&buf, "blap_app_failed{app=\"%s\"} %d\n", metricLabel(name), failed)
+	}
+	metric(failuresMetric, "counter", "Total application failures across (non-dryrun) runs, resets when the file is removed.")
+	if !dryrun {
+		failures += float64(len(s.failed))
+	}
+	fmt.Fprintf(&buf, "%s %g\n", failuresMetric, failures)
+	metric("blap_last_run_duration_seconds", "gauge", "Duration of the last run.")
+	fmt.Fprintf(&buf, "blap_last_run_duration_seconds %g\n", report.Elapsed)
+	metric("blap_last_run_timestamp", "gauge", "Unix timestamp of the last run.")
+	fmt.Fprintf(&buf, "blap_last_run_timestamp %d\n", time.Now().Unix())
+	return buf.Bytes()
+}
+
+func (c Configuration) writeMetrics(s *runSummary, report Summary) error {
+	file := c.Metrics.File.String()
+	if file == "" {
+		return nil
+	}
+	if report.Mode == "purge" {
+		c.context.LogDebug(logging.ProcessCategory, "purge, not writing metrics: %s\n", file)
+		return nil
+	}
+	failures := previousFailures(file)
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, s.metrics(report, failures, c.context.DryRun), 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		if util.PathExists(tmp) {
+			os.Remove(tmp)
+		}
+		return err
+	}
+	return nil
+}
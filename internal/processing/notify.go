@@ -0,0 +1,91 @@
+// Package processing handles run notifications
+package processing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/seanenck/blap/internal/fetch"
+	"github.com/seanenck/blap/internal/logging"
+	"github.com/seanenck/blap/internal/util"
+)
+
+const notifyTimeout = 30 * time.Second
+
+// Notification is the payload sent to webhooks/commands after a run
+type Notification struct {
+	Host    string   `json:"host"`
+	Changes []Change `json:"changes"`
+	Errors  []string `json:"errors"`
+}
+
+func flattenErrors(err error) []error {
+	if err == nil {
+		return nil
+	}
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return []error{err}
+	}
+	var res []error
+	for _, e := range joined.Unwrap() {
+		res = append(res, flattenErrors(e)...)
+	}
+	return res
+}
+
+func (c Configuration) notify(fetcher fetch.Retriever, runner util.Runner, changed []Change, result error) error {
+	if len(c.Notify.Webhooks) == 0 && len(c.Notify.Command) == 0 {
+		return nil
+	}
+	if c.context.Purge || c.context.DryRun {
+		return nil
+	}
+	n := Notification{Changes: changed}
+	for _, err := range flattenErrors(result) {
+		n.Errors = append(n.Errors, logging.Redact(err.Error()))
+	}
+	if len(n.Changes) == 0 && len(n.Errors) == 0 {
+		return nil
+	}
+	n.Host, _ = os.Hostname()
+	b, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	// the run context may already be cancelled (timeouts, signals), notifications are still sent
+	timeout := notifyTimeout
+	if c.Connections.Timeouts.Get > 0 {
+		timeout = time.Duration(c.Connections.Timeouts.Get) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var failed []error
+	for _, hook := range c.Notify.Webhooks {
+		url := hook.String()
+		if c.context.Offline {
+			c.context.LogDebug(logging.ProcessCategory, "offline, not notifying: %s\n", url)
+			continue
+		}
+		c.context.LogDebug(logging.ProcessCategory, "notifying: %s\n", url)
+		if err := fetcher.Post(ctx, url, "application/json", b); err != nil {
+			failed = append(failed, fmt.Errorf("notification failed: %s: %w", url, err))
+		}
+	}
+	if len(c.Notify.Command) > 0 {
+		var args []string
+		for _, a := range c.Notify.Command {
+			args = append(args, a.String())
+		}
+		c.context.LogDebug(logging.ProcessCategory, "notifying: %v\n", args)
+		if err := runner.WithContext(ctx).Run(util.RunSettings{Input: bytes.NewReader(b)}, args[0], args[1:]...); err != nil {
+			failed = append(failed, fmt.Errorf("notification failed: %s: %w", args[0], err))
+		}
+	}
+	return errors.Join(failed...)
+}
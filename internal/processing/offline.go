@@ -0,0 +1,143 @@
+// Package processing handles resolving applications offline from existing archives
+package processing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/seanenck/blap/internal/core"
+	"github.com/seanenck/blap/internal/logging"
+	"github.com/seanenck/blap/internal/steps"
+	"github.com/seanenck/blap/internal/util"
+)
+
+const (
+	resourceFile  = ".blap_resource"
+	partialSuffix = ".partial"
+)
+
+type archivedResource struct {
+	URL     string `json:"url"`
+	File    string `json:"file"`
+	Tag     string `json:"tag"`
+	Archive string `json:"archive"`
+	Unpack  string `json:"unpack"`
+}
+
+func writeResource(dir string, rsrc *core.Resource) error {
+	archived := archivedResource{URL: rsrc.URL, File: rsrc.File, Tag: rsrc.Tag}
+	archived.Archive = filepath.Base(rsrc.Paths.Archive)
+	archived.Unpack = filepath.Base(rsrc.Paths.Unpack)
+	b, err := json.Marshal(archived)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, resourceFile), b, 0o644)
+}
+
+// offlineResource resolves the last downloaded archive (in the application directory) when offline
+func (c Configuration) offlineResource(name, dir string, settings core.Extraction, resolveErr error) (*core.Resource, error) {
+	missing := fmt.Errorf("offline, no cached data or existing archive: %w", resolveErr)
+	rsrc, err := readResource(name, dir, settings)
+	if err != nil {
+		return nil, err
+	}
+	if rsrc == nil {
+		c.context.LogDebug(logging.FetchCategory, "offline, no resource data, scanning: %s\n", dir)
+		rsrc, err = existingResource(name, dir, settings)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if rsrc == nil || !util.PathExists(rsrc.Paths.Archive) {
+		return nil, missing
+	}
+	c.context.LogCore(logging.FetchCategory, "offline, using existing archive: %s (%s)\n", name, rsrc.Tag)
+	return rsrc, nil
+}
+
+func readResource(name, dir string, settings core.Extraction) (*core.Resource, error) {
+	b, err := os.ReadFile(filepath.Join(dir, resourceFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var archived archivedResource
+	if err := json.Unmarshal(b, &archived); err != nil {
+		return nil, err
+	}
+	rsrc := &core.Resource{URL: archived.URL, File: archived.File, Tag: archived.Tag}
+	if archived.Archive == "" || archived.Unpack == "" {
+		err = rsrc.SetAppData(name, dir, settings)
+	} else {
+		err = rsrc.SetExistingData(filepath.Join(dir, archived.Archive), filepath.Join(dir, archived.Unpack), settings)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rsrc, nil
+}
+
+// existingResource finds the newest extracted (tag) directory, and its archive, for an application without resource data
+func existingResource(name, dir string, settings core.Extraction) (*core.Resource, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	archives := make(map[string]string)
+	for _, e := range entries {
+		if e.IsDir() || strings.HasSuffix(e.Name(), partialSuffix) {
+			continue
+		}
+		if hash, file, ok := strings.Cut(e.Name(), "."); ok && file != "" {
+			archives[hash] = file
+		}
+	}
+	prefix := util.CleanFileName(name) + "."
+	marker := filepath.Base(steps.Directories{}.Installed())
+	var newest time.Time
+	var found *core.Resource
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		hash, rest, ok := strings.Cut(e.Name(), ".")
+		if !ok || !strings.HasPrefix(rest, prefix) {
+			continue
+		}
+		file, ok := archives[hash]
+		if !ok {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || info.ModTime().Before(newest) {
+			continue
+		}
+		unpack := filepath.Join(dir, e.Name())
+		tag := strings.TrimPrefix(rest, prefix)
+		if b, err := os.ReadFile(filepath.Join(unpack, marker)); err == nil {
+			tag = strings.TrimSpace(string(b))
+		}
+		if tag == "" {
+			continue
+		}
+		archive := filepath.Join(dir, fmt.Sprintf("%s.%s", hash, file))
+		rsrc := &core.Resource{URL: archive, File: file, Tag: tag}
+		if err := rsrc.SetExistingData(archive, unpack, settings); err != nil {
+			return nil, err
+		}
+		newest = info.ModTime()
+		found = rsrc
+	}
+	return found, nil
+}
@@ -2,13 +2,16 @@
 package processing
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"slices"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -27,11 +30,13 @@ var processLock = &sync.Mutex{}
 type (
 	// Change are update/purge change sets
 	Change struct {
-		Name    string
-		Details string
+		Name    string `json:"name"`
+		Details string `json:"details"`
 	}
 	processHandler struct {
 		changed []Change
+		builds  chan struct{}
+		summary *runSummary
 	}
 	// Executor is the process executor
 	Executor interface {
@@ -65,22 +70,38 @@ func (c Configuration) Do(ctx Context) error {
 	if c.handler == nil {
 		return errors.New("configuration not setup")
 	}
+	if c.dir == "" {
+		return errors.New("directory is required")
+	}
+	tag := ""
 	logger := func(action, detail string) {
 		msg := ""
 		if detail != "" {
 			msg = fmt.Sprintf(" (%s)", detail)
 		}
-		c.log(true, "%s: %s%s\n", action, ctx.Name, msg)
+		c.log(true, logging.Event{App: ctx.Name, Action: action, Tag: tag}, "%s: %s%s\n", action, ctx.Name, msg)
 	}
 	logger("processing", "")
+	started := time.Now()
 	rsrc, err := ctx.Fetcher.Process(fetch.Context{Name: ctx.Name}, ctx.Application.Items())
+	c.handler.summary.phase(fetchPhase, started)
+	to := filepath.Join(c.dir, ctx.Name)
+	existing := false
 	if err != nil {
-		return err
+		if !c.context.Offline {
+			return err
+		}
+		rsrc, err = c.offlineResource(ctx.Name, to, ctx.Application.Extract, err)
+		if err != nil {
+			return err
+		}
+		existing = true
 	}
 	if rsrc == nil {
 		return errors.New("unexpected nil resource")
 	}
-	to := filepath.Join(c.dir, ctx.Name)
+	tag = rsrc.Tag
+	c.handler.summary.tag(ctx.Name, tag)
 	hasDest := util.PathExists(to)
 	if !hasDest {
 		if c.context.Purge {
@@ -93,9 +114,16 @@ func (c Configuration) Do(ctx Context) error {
 			}
 		}
 	}
-	if err := rsrc.SetAppData(ctx.Name, to, ctx.Application.Extract); err != nil {
-		return err
+	if !existing {
+		if err := rsrc.SetAppData(ctx.Name, to, ctx.Application.Extract); err != nil {
+			return err
+		}
 	}
+	installed := previousTag(to, "")
+	if ctx.Application.Extract.Skip && util.PathExists(rsrc.Paths.Archive) {
+		installed = rsrc.Tag
+	}
+	c.handler.summary.deployed(ctx.Name, installed)
 	onChange := func(detail string) bool {
 		logger("transaction", fmt.Sprintf("%s, dryrun: %v", detail, c.context.DryRun))
 		obj := Change{Name: ctx.Name, Details: detail}
@@ -119,15 +147,35 @@ func (c Configuration) Do(ctx Context) error {
 			}
 			knownAssets = append(knownAssets, filepath.Base(f))
 		}
+		if util.PathExists(filepath.Join(to, resourceFile)) {
+			knownAssets = append(knownAssets, resourceFile)
+		}
 		logger("purge", "")
 		return ctx.Executor.Purge(to, knownAssets, onChange)
 	}
 
-	did, err := ctx.Fetcher.Download(c.context.DryRun, rsrc.URL, rsrc.Paths.Archive)
+	env := core.NewEnvironment(os.Environ()).With(c.Variables)
+	mirrors, err := mirrorURLs(ctx, rsrc, env)
+	if err != nil {
+		return err
+	}
+	started = time.Now()
+	did, err := ctx.Fetcher.Download(c.context.DryRun, rsrc.URL, rsrc.Paths.Archive, mirrors...)
+	c.handler.summary.phase(downloadPhase, started)
 	if err != nil {
 		return err
 	}
+	if !c.context.DryRun {
+		if err := writeResource(to, rsrc); err != nil {
+			return err
+		}
+	}
 	if did {
+		var size int64
+		if info, err := os.Stat(rsrc.Paths.Archive); err == nil {
+			size = info.Size()
+		}
+		c.handler.summary.download(ctx.Name, previousTag(to, rsrc.Paths.Unpack), size)
 		onChange(rsrc.Tag)
 	}
 	if c.context.DryRun {
@@ -136,6 +184,7 @@ func (c Configuration) Do(ctx Context) error {
 	}
 
 	if ctx.Application.Extract.Skip {
+		c.handler.summary.deployed(ctx.Name, rsrc.Tag)
 		c.context.LogDebug(logging.ExtractCategory, "no extraction, done: %s\n", rsrc.File)
 		if len(ctx.Application.Setup) > 0 {
 			c.context.LogCore(logging.ExtractCategory, "setup steps set for %s, but extraction disabled\n", ctx.Name)
@@ -143,11 +192,17 @@ func (c Configuration) Do(ctx Context) error {
 		return nil
 	}
 
+	output := c.newAppLog(ctx.Name)
+	defer output.Close()
+	runner := util.WithOutput(util.WithEnvironment(ctx.Runner, env.Environ(false)), output)
 	dest := rsrc.Paths.Unpack
 	if !util.PathExists(dest) {
 		c.context.LogDebug(logging.ExtractCategory, "extracting: %s\n", rsrc.File)
-		if err := rsrc.Extract(ctx.Runner); err != nil {
-			return err
+		started = time.Now()
+		err := rsrc.Extract(runner)
+		c.handler.summary.phase(extractPhase, started)
+		if err != nil {
+			return output.failed(c, ctx.Name, err)
 		}
 	}
 	vars := steps.NewVariables(ctx.Fetcher)
@@ -160,6 +215,7 @@ func (c Configuration) Do(ctx Context) error {
 	if !c.context.ReDeploy {
 		if !ctx.Application.Flags.ReDeploy() && util.PathExists(marker) {
 			logger("deployed", rsrc.Tag)
+			c.handler.summary.deployed(ctx.Name, rsrc.Tag)
 			return nil
 		}
 	}
@@ -175,15 +231,69 @@ func (c Configuration) Do(ctx Context) error {
 	step := steps.Context{}
 	step.Variables = e
 	step.Settings = c.context
-	if err := func() error {
-		processLock.Lock()
-		defer processLock.Unlock()
-		return steps.Do(ctx.Application.Setup, ctx.Runner, step, ctx.Application.CommandEnv())
-	}(); err != nil {
-		return err
+	step.Environment = env
+	if err := c.build(ctx, runner, step, output); err != nil {
+		return output.logged(err)
 	}
 	logger("commit", "")
-	return os.WriteFile(marker, []byte(vars.Tag), 0o644)
+	if err := os.WriteFile(marker, []byte(vars.Tag), 0o644); err != nil {
+		return err
+	}
+	c.handler.summary.deployed(ctx.Name, vars.Tag)
+	return nil
+}
+
+func mirrorURLs(ctx Context, rsrc *core.Resource, env core.Environment) ([]string, error) {
+	if len(ctx.Application.Mirrors) == 0 {
+		return nil, nil
+	}
+	vars := steps.NewVariables(ctx.Fetcher)
+	vars.File = rsrc.File
+	vars.Tag = rsrc.Tag
+	vars.URL = rsrc.URL
+	e, err := core.NewValues(ctx.Name, vars)
+	if err != nil {
+		return nil, err
+	}
+	e = e.WithEnvironment(env)
+	var mirrors []string
+	for _, m := range ctx.Application.Mirrors {
+		t, err := e.Template(string(m))
+		if err != nil {
+			return nil, err
+		}
+		mirrors = append(mirrors, core.Resolved(t).Expand(env.Getenv))
+	}
+	return mirrors, nil
+}
+
+func (c Configuration) build(ctx Context, runner util.Runner, step steps.Context, output *appLog) error {
+	if len(ctx.Application.Setup) == 0 {
+		return nil
+	}
+	if c.handler.builds != nil {
+		c.handler.builds <- struct{}{}
+		defer func() {
+			<-c.handler.builds
+		}()
+	}
+	defer c.handler.summary.phase(buildPhase, time.Now())
+	if c.Builds <= 1 {
+		step.Output = io.MultiWriter(output, os.Stdout)
+		return steps.Do(ctx.Application.Setup, runner, step, ctx.Application.CommandEnv())
+	}
+	var buf bytes.Buffer
+	step.Output = io.MultiWriter(output, &buf)
+	defer func() {
+		if buf.Len() == 0 || c.context.Writer == nil {
+			return
+		}
+		processLock.Lock()
+		defer processLock.Unlock()
+		fmt.Fprintf(c.context.Writer, "==> %s (build output)\n", ctx.Name)
+		io.WriteString(c.context.Writer, logging.Redact(buf.String()))
+	}()
+	return steps.Do(ctx.Application.Setup, runner, step, ctx.Application.CommandEnv())
 }
 
 // Purge will run purge on inputs
@@ -209,9 +319,15 @@ func (c Configuration) cleanDirectories(restrict []string) ([]string, error) {
 			continue
 		}
 		name := d.Name()
+		if slices.Contains([]string{logsDir, cacheDir}, name) {
+			continue
+		}
 		if _, ok := c.Apps[name]; ok {
 			continue
 		}
+		if _, ok := c.enabled[name]; ok {
+			continue
+		}
 		if restricted {
 			if !slices.Contains(restrict, name) {
 				continue
@@ -228,13 +344,16 @@ func (c Configuration) cleanDirectories(restrict []string) ([]string, error) {
 			continue
 		}
 		results = append(results, name)
-		c.log(false, "removing directory: %s\n", name)
+		c.log(false, logging.Event{App: name, Action: "clean"}, "removing directory: %s\n", name)
 		if c.context.DryRun {
 			continue
 		}
 		if err := os.RemoveAll(filepath.Join(dir, name)); err != nil {
 			return nil, err
 		}
+		if err := os.RemoveAll(c.appLogs(name)); err != nil {
+			return nil, err
+		}
 	}
 	return results, nil
 }
@@ -286,6 +405,9 @@ func (c Configuration) Process(executor Executor, fetcher fetch.Retriever, runne
 	if c.Parallelization < 0 {
 		return fmt.Errorf("parallelization must be >= 0 (have: %d)", c.Parallelization)
 	}
+	if c.Builds < 0 {
+		return fmt.Errorf("builds must be >= 0 (have: %d)", c.Builds)
+	}
 	if !c.Indexing.Enabled && c.Indexing.Strict {
 		return errors.New("can not enable strict indexing without indexing enabled")
 	}
@@ -298,12 +420,13 @@ func (c Configuration) Process(executor Executor, fetcher fetch.Retriever, runne
 	if c.context.Purge {
 		mode = "purge"
 	}
-	if err := logging.Rotate(c.logFile, c.Logging.Size, func() {
+	rotation := logging.Rotation{Size: c.Logging.Size, Keep: c.Logging.Keep, Compress: c.Logging.Compress, Age: c.Logging.Age}
+	if err := logging.Rotate(c.logFile, rotation, func() {
 		c.context.LogDebug(logging.SelfCategory, "rotating log file")
 	}); err != nil {
 		return err
 	}
-	c.log(true, "mode: %s\n", mode)
+	c.log(true, logging.Event{Action: mode}, "mode: %s\n", mode)
 	indexFile := c.IndexFile(mode)
 	idx := Index{}
 	if c.Indexing.Enabled {
@@ -326,161 +449,159 @@ func (c Configuration) Process(executor Executor, fetcher fetch.Retriever, runne
 	}
 	hasIndex := len(idx.Names) > 0
 	fetcher.SetConnections(c.Connections)
-	var priorities []int
-	prioritySet := make(map[int][]Context)
+	fetcher.SetEnvironment(core.NewEnvironment(os.Environ()).With(c.Variables))
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	if c.Connections.Timeouts.All > 0 {
+		m := max(c.Connections.Timeouts.Command, c.Connections.Timeouts.Get, c.Connections.Timeouts.Download)
+		if m > c.Connections.Timeouts.All {
+			return fmt.Errorf("timeout exceeds configured 'all' settings: %d > %d", m, c.Connections.Timeouts.All)
+		}
+		var timeout context.CancelFunc
+		ctx, timeout = context.WithTimeout(ctx, time.Duration(c.Connections.Timeouts.All)*time.Second)
+		defer timeout()
+	}
+	c.handler.builds = make(chan struct{}, max(c.Builds, 1))
+	summary := newRunSummary(c.skipped)
+	c.handler.summary = summary
+	fetcher.SetContext(ctx)
+	runner = runner.WithContext(ctx)
+	if err := c.runHooks(false, mode, fetcher, runner, nil); err != nil {
+		return err
+	}
+	var apps []Context
 	for name, app := range c.Apps {
 		if hasIndex {
 			if !slices.Contains(idx.Names, name) {
+				summary.skip(name, "not indexed")
 				continue
 			}
 		}
-		has, ok := prioritySet[app.Priority]
-		if !ok {
-			has = []Context{}
-			priorities = append(priorities, app.Priority)
+		apps = append(apps, Context{Name: name, Application: app, Fetcher: fetcher, Runner: runner, Executor: executor})
+	}
+	schedule := newSchedule(apps)
+	schedule.unscheduled(func(name, dependency string) {
+		reason := summary.skippedReason(dependency)
+		if reason == "" {
+			reason = "not enabled"
+		}
+		c.context.LogCore(logging.ProcessCategory, "warning: %s depends on %s which is not processed (%s), ordering is ignored\n", name, dependency, reason)
+	})
+	pErrors, err := schedule.run(ctx, c.Parallelization, func(app Context) error {
+		started := time.Now()
+		err := executor.Do(app)
+		if err != nil {
+			c.log(true, logging.Event{App: app.Name, Action: "failed", Error: err.Error()}, "failed: %s\n", app.Name)
 		}
-		has = append(has, Context{Name: name, Application: app, Fetcher: fetcher, Runner: runner, Executor: executor})
-		prioritySet[app.Priority] = has
+		summary.result(app.Name, time.Since(started), err)
+		return err
+	})
+	changed := executor.Changed()
+	report := summary.report(mode, c.context.DryRun, changed)
+	if sErr := c.writeSummary(report); sErr != nil {
+		pErrors = append(pErrors, sErr)
 	}
-	sort.Ints(priorities)
-	slices.Reverse(priorities)
-	environ := c.Variables.Set()
-	var timeout *time.Duration
-	if c.Connections.Timeouts.All > 0 {
-		m := max(c.Connections.Timeouts.Command, c.Connections.Timeouts.Get)
-		if m > c.Connections.Timeouts.All {
-			return fmt.Errorf("timeout exceeds configured 'all' settings: %d > %d", m, c.Connections.Timeouts.All)
+	if mErr := c.writeMetrics(summary, report); mErr != nil {
+		pErrors = append(pErrors, mErr)
+	}
+	result := func() error {
+		if err != nil {
+			return errors.Join(append(pErrors, err)...)
 		}
-		wait := time.Duration(c.Connections.Timeouts.All) * time.Second
-		timeout = &wait
-	}
-	defer environ.Unset()
-	var pErrors []error
-	for _, p := range priorities {
-		apps := prioritySet[p]
-		appErrors := make(chan error, len(apps))
-		var wg sync.WaitGroup
-		count := 0
-		for _, a := range apps {
-			wg.Add(1)
-			go func(ctx Context) {
-				defer wg.Done()
-				var cErr error
-				if err := executor.Do(ctx); err != nil {
-					cErr = fmt.Errorf("application '%s' error: %v", ctx.Name, err)
+		isDryRun := false
+		newIndex := Index{}
+		if c.context.Purge {
+			if c.context.CleanDirs {
+				dirs := idx.Dirs
+				if c.context.DryRun {
+					dirs = []string{}
 				}
-				appErrors <- cErr
-			}(a)
-			count++
-			if c.Parallelization == 0 || count > c.Parallelization {
-				if err := isTimeout(&wg, timeout); err != nil {
+				results, err := c.cleanDirectories(dirs)
+				if err != nil {
 					return err
 				}
-				count = 0
+				if c.context.DryRun && len(results) > 0 {
+					newIndex.Dirs = results
+					isDryRun = true
+				}
 			}
 		}
-		if err := isTimeout(&wg, timeout); err != nil {
-			return err
-		}
-		for len(appErrors) > 0 {
-			if err := <-appErrors; err != nil {
-				pErrors = append(pErrors, err)
+		if len(changed) > 0 {
+			msg := "updating"
+			t := "tag"
+			action := "update"
+			if c.context.Purge {
+				msg = "purging"
+				t = "filesystem"
+				action = "purge"
 			}
-		}
-	}
-	changed := executor.Changed()
-	isDryRun := false
-	newIndex := Index{}
-	if c.context.Purge {
-		if c.context.CleanDirs {
-			dirs := idx.Dirs
+			doIndex := false
 			if c.context.DryRun {
-				dirs = []string{}
-			}
-			results, err := c.cleanDirectories(dirs)
-			if err != nil {
-				return err
-			}
-			if c.context.DryRun && len(results) > 0 {
-				newIndex.Dirs = results
+				doIndex = true
 				isDryRun = true
 			}
+			for _, change := range changed {
+				event := logging.Event{App: change.Name, Action: action}
+				if !c.context.Purge {
+					event.Tag = change.Details
+				}
+				if err := c.log(false, event, "%s: %s (%s -> %s)\n", msg, change.Name, t, change.Details); err != nil {
+					return err
+				}
+				if doIndex {
+					newIndex.Names = append(newIndex.Names, change.Name)
+				}
+			}
 		}
-	}
-	if len(changed) > 0 {
-		msg := "updating"
-		t := "tag"
-		if c.context.Purge {
-			msg = "purging"
-			t = "filesystem"
+		if err := c.runHooks(true, mode, fetcher, runner, changed); err != nil {
+			pErrors = append(pErrors, err)
 		}
-		doIndex := false
-		if c.context.DryRun {
-			doIndex = true
-			isDryRun = true
+		if len(pErrors) > 0 {
+			return errors.Join(pErrors...)
 		}
-		for _, change := range changed {
-			if err := c.log(false, "%s: %s (%s -> %s)\n", msg, change.Name, t, change.Details); err != nil {
-				return err
+		if c.Indexing.Enabled {
+			removeIndex := util.PathExists(indexFile)
+			if c.context.DryRun && (len(newIndex.Dirs) > 0 || len(newIndex.Names) > 0) {
+				removeIndex = false
+				b, err := json.Marshal(newIndex)
+				if err != nil {
+					return err
+				}
+				if err := os.WriteFile(indexFile, b, 0o644); err != nil {
+					return err
+				}
 			}
-			if doIndex {
-				newIndex.Names = append(newIndex.Names, change.Name)
+			if removeIndex {
+				return os.Remove(indexFile)
 			}
 		}
-	}
-	if len(pErrors) > 0 {
-		return errors.Join(pErrors...)
-	}
-	if c.Indexing.Enabled {
-		removeIndex := util.PathExists(indexFile)
-		if c.context.DryRun && (len(newIndex.Dirs) > 0 || len(newIndex.Names) > 0) {
-			removeIndex = false
-			b, err := json.Marshal(newIndex)
-			if err != nil {
-				return err
-			}
-			if err := os.WriteFile(indexFile, b, 0o644); err != nil {
+		if isDryRun {
+			if err := c.log(false, logging.Event{Action: "dryrun"}, "\n[DRYRUN] impactful changes were not committed\n"); err != nil {
 				return err
 			}
 		}
-		if removeIndex {
-			return os.Remove(indexFile)
-		}
-	}
-	if isDryRun {
-		if err := c.log(false, "\n[DRYRUN] impactful changes were not committed\n"); err != nil {
-			return err
-		}
+		return nil
+	}()
+	if nErr := c.notify(fetcher, runner, changed, result); nErr != nil {
+		return errors.Join(result, nErr)
 	}
-	return nil
+	return result
 }
 
-func (c Configuration) log(debug bool, msg string, parts ...any) error {
+func (c Configuration) log(debug bool, event logging.Event, msg string, parts ...any) error {
 	processLock.Lock()
 	defer processLock.Unlock()
 	fxn := c.context.LogCore
 	if debug {
 		fxn = c.context.LogDebug
 	}
-	fxn(logging.ProcessCategory, msg, parts...)
-	return logging.Append(c.logFile, msg, parts...)
-}
-
-func isTimeout(wg *sync.WaitGroup, wait *time.Duration) error {
-	if wait == nil {
-		wg.Wait()
-		return nil
+	if event.Category == "" {
+		event.Category = logging.ProcessCategory
 	}
-	timeout := *wait
-	c := make(chan struct{})
-	go func() {
-		defer close(c)
-		wg.Wait()
-	}()
-	select {
-	case <-c:
+	fxn(event.Category, msg, parts...)
+	if debug && !c.context.CategoryEnabled(event.Category) {
 		return nil
-	case <-time.After(timeout):
-		return errors.New("timeout reached for application processing")
 	}
+	event.Message = fmt.Sprintf(msg, parts...)
+	return logging.AppendEvent(c.logFile, c.Logging.Format, event)
 }
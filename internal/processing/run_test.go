@@ -2,12 +2,16 @@ package processing_test
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"iter"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 
@@ -31,6 +35,17 @@ type mockExecutor struct {
 	calledDo    int
 	calledPurge int
 	calledMulti int
+	lastEnv     []string
+	mirrors     []string
+	posted      []string
+	payload     []byte
+	postErr     error
+	input       []byte
+	lastCmd     string
+	failOn      string
+	procErr     error
+	changes     []processing.Change
+	globals     *core.Environment
 }
 
 func genCleanup() func() {
@@ -69,14 +84,49 @@ func (m *mockExecutor) Do(ctx processing.Context) error {
 	return m.err
 }
 
-func (m *mockExecutor) Download(bool, string, string) (bool, error) {
+func (m *mockExecutor) Download(_ bool, _ string, _ string, mirrors ...string) (bool, error) {
+	m.mirrors = mirrors
 	return m.dl, m.err
 }
 
 func (m *mockExecutor) SetConnections(core.Connections) {
 }
 
+func (m *mockExecutor) Post(ctx context.Context, url, _ string, body []byte) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	m.posted = append(m.posted, url)
+	m.payload = body
+	return m.postErr
+}
+
+func (m *mockExecutor) SetContext(context.Context) {
+}
+
+func (m *mockExecutor) SetEnvironment(env core.Environment) {
+	m.globals = &env
+}
+
+func (m *mockExecutor) Getenv(key string) string {
+	if m.globals == nil {
+		return os.Getenv(key)
+	}
+	return m.globals.Getenv(key)
+}
+
+func (m *mockExecutor) Lookup(_ string, fxn func() ([]byte, error)) ([]byte, error) {
+	return fxn()
+}
+
+func (m *mockExecutor) WithContext(context.Context) util.Runner {
+	return m
+}
+
 func (m *mockExecutor) Process(fetch.Context, iter.Seq[any]) (*core.Resource, error) {
+	if m.procErr != nil {
+		return nil, m.procErr
+	}
 	return m.rsrc, m.err
 }
 
@@ -89,6 +139,17 @@ func (m *mockExecutor) Output(string, ...string) ([]byte, error) {
 }
 
 func (m *mockExecutor) Run(s util.RunSettings, c string, a ...string) error {
+	m.lastEnv = s.Env.Values
+	m.lastCmd = c
+	if s.Input != nil {
+		m.input, _ = io.ReadAll(s.Input)
+	}
+	if s.Output != nil {
+		fmt.Fprintf(s.Output, "%s output\n", c)
+	}
+	if m.failOn != "" && m.failOn == c {
+		return fmt.Errorf("%s failed", c)
+	}
 	return m.RunCommand(c, a...)
 }
 
@@ -96,6 +157,9 @@ func (m *mockExecutor) Changed() []processing.Change {
 	if m.static {
 		return nil
 	}
+	if m.changes != nil {
+		return m.changes
+	}
 	return []processing.Change{{Name: "abc", Details: "1 details"}, {Name: "xyz", Details: "other"}}
 }
 
@@ -198,8 +262,8 @@ func TestProcessUpdate(t *testing.T) {
 	if m.name != "nvim" {
 		t.Errorf("last app should be nvim: %s", m.name)
 	}
-	if !m.env {
-		t.Errorf("env var not set")
+	if m.env {
+		t.Errorf("env var should not be set in the process environment")
 	}
 	m.calledDo = 0
 	cfg, _ = processing.Load(filepath.Join("examples", "config.toml"), s)
@@ -397,6 +461,52 @@ func TestConfigurationDo(t *testing.T) {
 	if !strings.Contains(str, "no extraction") || !strings.Contains(str, "steps set for") {
 		t.Error("should not extract")
 	}
+	cfg, _ = processing.Load(filepath.Join("examples", "config.toml"), s)
+	f.rsrc = &core.Resource{File: "xyz.tar.xz", URL: "xxx", Tag: "123"}
+	app = core.Application{}
+	app.Extract.NoDepth = true
+	app.ClearEnv = true
+	app.Setup = append(app.Setup, core.Step{Commands: []interface{}{"exe"}})
+	r := &mockExecutor{}
+	if err := cfg.Do(processing.Context{Application: app, Fetcher: f, Name: "env", Runner: r, Executor: &mockExecutor{}}); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if fmt.Sprintf("%v", r.lastEnv) != "[ENV_KEY=some_values LDFLAGS=-X -y]" {
+		t.Errorf("invalid env: %v", r.lastEnv)
+	}
+	if strings.Contains(buf.String(), "exe output") {
+		t.Error("output should not be buffered")
+	}
+	var logs bytes.Buffer
+	if err := cfg.Logs(&logs, "env"); err != nil || logs.String() != "tar output\nexe output\n" {
+		t.Errorf("invalid logs: %s %v", logs.String(), err)
+	}
+	if err := cfg.Logs(&logs, "build"); err == nil || err.Error() != "no logs found for application: build" {
+		t.Errorf("invalid error: %v", err)
+	}
+	cfg, _ = processing.Load(filepath.Join("examples", "config.toml"), s)
+	cfg.Builds = 2
+	f.rsrc = &core.Resource{File: "xyz.tar.xz", URL: "xxx", Tag: "123"}
+	if err := cfg.Do(processing.Context{Application: app, Fetcher: f, Name: "buffered", Runner: r, Executor: &mockExecutor{}}); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "==> buffered (build output)\nexe output\n") {
+		t.Errorf("invalid output: %s", buf.String())
+	}
+	logs.Reset()
+	if err := cfg.Logs(&logs, "buffered"); err != nil || logs.String() != "tar output\nexe output\n" {
+		t.Errorf("invalid logs: %s %v", logs.String(), err)
+	}
+	cfg, _ = processing.Load(filepath.Join("examples", "config.toml"), s)
+	f.rsrc = &core.Resource{File: "xyz.tar.xz", URL: "xxx", Tag: "123"}
+	r.err = errors.New("build failed")
+	err := cfg.Do(processing.Context{Application: app, Fetcher: f, Name: "build", Runner: r, Executor: &mockExecutor{}})
+	if err == nil || !strings.HasPrefix(err.Error(), "build failed (log: testdata/.logs/build/") {
+		t.Errorf("invalid error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "==> build failed, last 1 line(s) of: testdata/.logs/build/") || !strings.HasSuffix(buf.String(), ".log\ntar output\n") {
+		t.Errorf("invalid output: %s", buf.String())
+	}
 }
 
 func TestReDeploy(t *testing.T) {
@@ -850,6 +960,88 @@ func TestLogging(t *testing.T) {
 	}
 }
 
+func TestLoggingJSON(t *testing.T) {
+	os.RemoveAll("testdata")
+	os.Mkdir("testdata", 0o755)
+	defer func() {
+		os.RemoveAll("testdata")
+	}()
+	m := &mockExecutor{}
+	s := cli.Settings{}
+	b, _ := os.ReadFile(filepath.Join("examples", "config.toml"))
+	logFile := filepath.Join("testdata", "blap.log")
+	data := strings.ReplaceAll(string(b), "file = \"\"", fmt.Sprintf("file = \"%s\"", logFile))
+	to := filepath.Join("testdata", "config.toml")
+	os.WriteFile(filepath.Join("testdata", "test.toml"), []byte{}, 0o644)
+	os.WriteFile(to, []byte(strings.ReplaceAll(data, "format = \"text\"", "format = \"xml\"")), 0o644)
+	if _, err := processing.Load(to, s); err == nil || err.Error() != "unknown log format: xml" {
+		t.Errorf("invalid error: %v", err)
+	}
+	os.WriteFile(to, []byte(strings.ReplaceAll(data, "format = \"text\"", "format = \"json\"")), 0o644)
+	cfg, err := processing.Load(to, s)
+	if err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if err := cfg.Process(m, m, m); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	b, _ = os.ReadFile(logFile)
+	var events []logging.Event
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var event logging.Event
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Errorf("invalid json: %s %v", line, err)
+		}
+		if event.Timestamp == "" || event.Category != logging.ProcessCategory {
+			t.Errorf("invalid event: %v", event)
+		}
+		events = append(events, event)
+	}
+	if len(events) != 3 {
+		t.Fatalf("invalid events: %v", events)
+	}
+	if e := events[0]; e.Action != "update" || e.App != "" || e.Message != "mode: update" {
+		t.Errorf("invalid event: %v", e)
+	}
+	if e := events[1]; e.Action != "update" || e.App != "abc" || e.Tag != "1 details" || e.Message != "updating: abc (tag -> 1 details)" {
+		t.Errorf("invalid event: %v", e)
+	}
+}
+
+func TestLoggingCategories(t *testing.T) {
+	os.RemoveAll("testdata")
+	os.Mkdir("testdata", 0o755)
+	defer func() {
+		os.RemoveAll("testdata")
+	}()
+	m := &mockExecutor{}
+	b, _ := os.ReadFile(filepath.Join("examples", "config.toml"))
+	logFile := filepath.Join("testdata", "blap.log")
+	data := strings.ReplaceAll(string(b), "file = \"\"", fmt.Sprintf("file = \"%s\"", logFile))
+	to := filepath.Join("testdata", "config.toml")
+	os.WriteFile(filepath.Join("testdata", "test.toml"), []byte{}, 0o644)
+	os.WriteFile(to, []byte(strings.ReplaceAll(data, "categories = []", "categories = [\"other\"]")), 0o644)
+	s, _ := cli.Parse(nil, cli.UpgradeCommand, []string{})
+	if _, err := processing.Load(to, *s); err == nil || err.Error() != "unknown log category: other" {
+		t.Errorf("invalid error: %v", err)
+	}
+	os.WriteFile(to, []byte(strings.ReplaceAll(data, "categories = []", "categories = [\"github\"]")), 0o644)
+	cfg, err := processing.Load(to, *s)
+	if err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if !s.CategoryEnabled(logging.GitHubCategory) || s.CategoryEnabled(logging.ProcessCategory) {
+		t.Error("configured categories not set")
+	}
+	if err := cfg.Process(m, m, m); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	b, _ = os.ReadFile(logFile)
+	if str := string(b); strings.Contains(str, "mode: update") || !strings.Contains(str, "updating: abc") {
+		t.Errorf("invalid log: %s", str)
+	}
+}
+
 func TestLock(t *testing.T) {
 	defer genCleanup()()
 	f := filepath.Join("testdata", "lock")
@@ -864,3 +1056,509 @@ func TestLock(t *testing.T) {
 		t.Errorf("invalid error: %v", err)
 	}
 }
+
+func TestCleanDirsFiltered(t *testing.T) {
+	defer genCleanup()()
+	m := &mockExecutor{}
+	s := cli.Settings{}
+	s.Purge = true
+	s.CleanDirs = true
+	s.CompileApplicationFilters(nil, []string{"nvim"}, false)
+	os.Mkdir(filepath.Join("testdata", "abc"), 0o755)
+	os.Mkdir(filepath.Join("testdata", "blap"), 0o755)
+	os.WriteFile(filepath.Join("testdata", "test.toml"), []byte{}, 0o644)
+	cfg, err := processing.Load(filepath.Join("examples", "config.toml"), s)
+	if err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if err := cfg.Process(m, m, m); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if util.PathExists(filepath.Join("testdata", "abc")) || !util.PathExists(filepath.Join("testdata", "blap")) {
+		t.Error("only orphaned directories should be removed")
+	}
+}
+
+func TestMirrors(t *testing.T) {
+	os.Mkdir("testdata", 0o755)
+	defer func() {
+		os.RemoveAll("testdata")
+	}()
+	t.Setenv("MIRROR_HOST", "cache.local")
+	s := cli.Settings{}
+	s.DryRun = true
+	cfg, _ := processing.Load(filepath.Join("examples", "config.toml"), s)
+	f := &mockExecutor{}
+	f.rsrc = &core.Resource{File: "xyz.tar.xz", URL: "xxx", Tag: "123"}
+	app := core.Application{}
+	app.Mirrors = []core.Resolved{"https://$MIRROR_HOST/{{ $.Name }}/{{ $.Vars.Tag }}/{{ $.Vars.File }}", "https://other/{{ $.Vars.URL }}"}
+	if err := cfg.Do(processing.Context{Application: app, Fetcher: f, Name: "mirror", Runner: &mockExecutor{}, Executor: &mockExecutor{}}); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if fmt.Sprintf("%v", f.mirrors) != "[https://cache.local/mirror/123/xyz.tar.xz https://other/xxx]" {
+		t.Errorf("invalid mirrors: %v", f.mirrors)
+	}
+	app.Mirrors = []core.Resolved{"{{ $.Vars.Tag "}
+	if err := cfg.Do(processing.Context{Application: app, Fetcher: f, Name: "mirror", Runner: &mockExecutor{}, Executor: &mockExecutor{}}); err == nil {
+		t.Error("expected template error")
+	}
+}
+
+func TestRedactedLogs(t *testing.T) {
+	os.Mkdir("testdata", 0o755)
+	defer func() {
+		os.RemoveAll("testdata")
+	}()
+	s := cli.Settings{}
+	s.Verbosity = 100
+	var buf bytes.Buffer
+	s.Writer = &buf
+	cfg, _ := processing.Load(filepath.Join("examples", "config.toml"), s)
+	f := &mockExecutor{}
+	f.rsrc = &core.Resource{File: "xyz.tar.xz", URL: "xxx", Tag: "123"}
+	app := core.Application{}
+	app.Extract.NoDepth = true
+	app.Variables = core.Variables{{Key: "TOKEN", Value: "app-secret-value", Secret: true}}
+	app.Setup = append(app.Setup, core.Step{Commands: []interface{}{"$TOKEN"}})
+	if err := cfg.Do(processing.Context{Application: app, Fetcher: f, Name: "redacted", Runner: &mockExecutor{}, Executor: &mockExecutor{}}); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	var logs bytes.Buffer
+	if err := cfg.Logs(&logs, "redacted"); err != nil || logs.String() != "tar output\n[redacted] output\n" {
+		t.Errorf("invalid logs: %s %v", logs.String(), err)
+	}
+	if str := buf.String(); strings.Contains(str, "app-secret-value") || !strings.Contains(str, "command: [redacted]") {
+		t.Errorf("invalid output: %s", str)
+	}
+}
+
+func TestGlobalEnvironment(t *testing.T) {
+	os.Mkdir("testdata", 0o755)
+	defer func() {
+		os.RemoveAll("testdata")
+	}()
+	to := filepath.Join("testdata", "config.toml")
+	os.WriteFile(to, []byte(`directory = "testdata"
+[[variables]]
+key = "GLOBAL_KEY"
+value = "global"
+[apps.abc]
+extract = { skip = true }
+[apps.abc.static]
+url = "https://example.com/abc.tar.gz"
+tag = "1"
+`), 0o644)
+	cfg, _ := processing.Load(to, cli.Settings{})
+	f := &mockExecutor{rsrc: &core.Resource{File: "abc.tar.gz", URL: "https://example.com/abc.tar.gz", Tag: "1"}}
+	if err := cfg.Process(cfg, f, &mockExecutor{}); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if f.globals == nil || f.Getenv("GLOBAL_KEY") != "global" || os.Getenv("GLOBAL_KEY") != "" {
+		t.Errorf("invalid fetcher environment: %v", f.globals)
+	}
+	cfg, _ = processing.Load(filepath.Join("examples", "config.toml"), cli.Settings{})
+	f = &mockExecutor{}
+	f.rsrc = &core.Resource{File: "xyz.tar.xz", URL: "xxx", Tag: "123"}
+	app := core.Application{}
+	app.Extract.NoDepth = true
+	runner := &mockExecutor{}
+	if err := cfg.Do(processing.Context{Application: app, Fetcher: f, Name: "extracted", Runner: runner, Executor: &mockExecutor{}}); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if runner.lastCmd != "tar" || !slices.Contains(runner.lastEnv, "ENV_KEY=some_values") {
+		t.Errorf("invalid extraction environment: %s %v", runner.lastCmd, runner.lastEnv)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	os.Mkdir("testdata", 0o755)
+	defer func() {
+		os.RemoveAll("testdata")
+	}()
+	b, _ := os.ReadFile(filepath.Join("examples", "config.toml"))
+	summaryFile := filepath.Join("testdata", "summary.json")
+	data := strings.ReplaceAll(string(b), "#file = \"~/.local/state/blap.summary.md\"", fmt.Sprintf("file = \"%s\"", summaryFile))
+	to := filepath.Join("testdata", "config.toml")
+	os.WriteFile(filepath.Join("testdata", "test.toml"), []byte{}, 0o644)
+	os.WriteFile(to, []byte(strings.ReplaceAll(data, "format = \"markdown\"", "format = \"xml\"")), 0o644)
+	if _, err := processing.Load(to, cli.Settings{}); err == nil || err.Error() != "unknown summary format: xml" {
+		t.Errorf("invalid error: %v", err)
+	}
+	os.WriteFile(to, []byte(strings.ReplaceAll(data, "format = \"markdown\"", "format = \"json\"")), 0o644)
+	s := cli.Settings{}
+	s.Verbosity = cli.InfoVerbosity
+	var buf bytes.Buffer
+	s.Writer = &buf
+	cfg, err := processing.Load(to, s)
+	if err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	m := &mockExecutor{}
+	if err := cfg.Process(m, m, m); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	b, _ = os.ReadFile(summaryFile)
+	var summary processing.Summary
+	if err := json.Unmarshal(b, &summary); err != nil {
+		t.Errorf("invalid json: %v", err)
+	}
+	if summary.Mode != "update" || len(summary.Changed) != 2 || summary.Changed[0].Name != "abc" || summary.Changed[0].To != "1 details" || len(summary.Failed) != 0 || len(summary.Phases) != 4 {
+		t.Errorf("invalid summary: %v", summary)
+	}
+	if !slices.Contains(summary.Skipped, processing.SummarySkip{Name: "nvim2", Reason: "pinned"}) {
+		t.Errorf("invalid skipped: %v", summary.Skipped)
+	}
+	if str := buf.String(); !strings.Contains(str, "summary (update, dryrun: false)") || !strings.Contains(str, "updated  abc") {
+		t.Errorf("invalid output: %s", str)
+	}
+	os.WriteFile(to, []byte(strings.ReplaceAll(data, "summary.json", "summary.md")), 0o644)
+	cfg, _ = processing.Load(to, cli.Settings{})
+	m = &mockExecutor{err: errors.New("first\nsecond")}
+	if err := cfg.Process(m, m, m); err == nil {
+		t.Error("expected failures")
+	}
+	b, _ = os.ReadFile(filepath.Join("testdata", "summary.md"))
+	if str := string(b); !strings.Contains(str, "| status | application | details |") || !strings.Contains(str, "| failed | nvim | first |") || strings.Contains(str, "second") {
+		t.Errorf("invalid markdown: %s", str)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	os.Mkdir("testdata", 0o755)
+	defer func() {
+		os.RemoveAll("testdata")
+	}()
+	b, _ := os.ReadFile(filepath.Join("examples", "config.toml"))
+	metricsFile := filepath.Join("testdata", "blap.prom")
+	data := strings.ReplaceAll(string(b), "#file = \"/var/lib/node_exporter/textfile/blap.prom\"", fmt.Sprintf("file = \"%s\"", metricsFile))
+	to := filepath.Join("testdata", "config.toml")
+	os.WriteFile(filepath.Join("testdata", "test.toml"), []byte{}, 0o644)
+	os.WriteFile(to, []byte(data), 0o644)
+	cfg, err := processing.Load(to, cli.Settings{})
+	if err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	m := &mockExecutor{}
+	if err := cfg.Process(m, m, m); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	b, _ = os.ReadFile(metricsFile)
+	str := string(b)
+	for _, expect := range []string{
+		"# TYPE blap_app_update_available gauge\n",
+		"blap_app_failed{app=\"nvim\"} 0\n",
+		"blap_app_duration_seconds{app=\"nvim\"} ",
+		"blap_run_failures_total 0\n",
+		"blap_last_run_timestamp ",
+	} {
+		if !strings.Contains(str, expect) {
+			t.Errorf("missing metric: %s in %s", expect, str)
+		}
+	}
+	if util.PathExists(metricsFile + ".tmp") {
+		t.Error("temporary metrics file should be removed")
+	}
+	for range 2 {
+		cfg, _ = processing.Load(to, cli.Settings{})
+		m = &mockExecutor{err: errors.New("failed")}
+		if err := cfg.Process(m, m, m); err == nil {
+			t.Error("expected failures")
+		}
+	}
+	b, _ = os.ReadFile(metricsFile)
+	str = string(b)
+	count := strings.Count(str, "blap_app_failed{")
+	if count == 0 || !strings.Contains(str, fmt.Sprintf("blap_run_failures_total %d\n", 2*count)) || !strings.Contains(str, "blap_app_failed{app=\"nvim\"} 1\n") {
+		t.Errorf("invalid failures: %s", str)
+	}
+	s := cli.Settings{}
+	s.DryRun = true
+	cfg, _ = processing.Load(to, s)
+	m = &mockExecutor{err: errors.New("failed")}
+	if err := cfg.Process(m, m, m); err == nil {
+		t.Error("expected failures")
+	}
+	b, _ = os.ReadFile(metricsFile)
+	str = string(b)
+	if !strings.Contains(str, fmt.Sprintf("blap_run_failures_total %d\n", 2*count)) || !strings.Contains(str, "blap_app_failed{app=\"nvim\"} 1\n") {
+		t.Errorf("dryrun should not add failures: %s", str)
+	}
+	s.DryRun = false
+	s.Purge = true
+	cfg, _ = processing.Load(to, s)
+	m = &mockExecutor{}
+	if err := cfg.Process(m, m, m); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if b, _ = os.ReadFile(metricsFile); string(b) != str {
+		t.Errorf("purge should not replace metrics: %s", string(b))
+	}
+}
+
+func TestMetricsUpdates(t *testing.T) {
+	os.Mkdir("testdata", 0o755)
+	defer func() {
+		os.RemoveAll("testdata")
+	}()
+	metricsFile := filepath.Join("testdata", "blap.prom")
+	to := filepath.Join("testdata", "config.toml")
+	os.WriteFile(to, []byte(fmt.Sprintf(`directory = "testdata"
+[metrics]
+file = "%s"
+[apps.abc]
+extract = { skip = true }
+[apps.abc.static]
+url = "https://example.com/abc.tar.gz"
+tag = "2"
+`, metricsFile)), 0o644)
+	os.MkdirAll(filepath.Join("testdata", "abc", "abc.1"), 0o755)
+	os.WriteFile(filepath.Join("testdata", "abc", "abc.1", ".blap_installed"), []byte("1"), 0o644)
+	f := &mockExecutor{dl: true, rsrc: &core.Resource{File: "abc.tar.gz", URL: "https://example.com/abc.tar.gz", Tag: "2"}}
+	for _, dryrun := range []bool{true, false} {
+		s := cli.Settings{}
+		s.DryRun = dryrun
+		cfg, err := processing.Load(to, s)
+		if err != nil {
+			t.Fatalf("invalid error: %v", err)
+		}
+		if err := cfg.Process(cfg, f, &mockExecutor{}); err != nil {
+			t.Errorf("invalid error: %v", err)
+		}
+		b, _ := os.ReadFile(metricsFile)
+		str := string(b)
+		installed, available := "1", 1
+		if !dryrun {
+			installed, available = "2", 0
+		}
+		if !strings.Contains(str, fmt.Sprintf("blap_app_installed_info{app=\"abc\",tag=\"%s\"} 1\n", installed)) || !strings.Contains(str, fmt.Sprintf("blap_app_update_available{app=\"abc\"} %d\n", available)) {
+			t.Errorf("invalid metrics (dryrun: %v): %s", dryrun, str)
+		}
+	}
+}
+
+func TestNotify(t *testing.T) {
+	os.Mkdir("testdata", 0o755)
+	defer func() {
+		os.RemoveAll("testdata")
+	}()
+	b, _ := os.ReadFile(filepath.Join("examples", "config.toml"))
+	to := filepath.Join("testdata", "config.toml")
+	os.WriteFile(filepath.Join("testdata", "test.toml"), []byte{}, 0o644)
+	os.WriteFile(to, b, 0o644)
+	s := cli.Settings{}
+	s.DryRun = true
+	cfg, _ := processing.Load(to, s)
+	m := &mockExecutor{}
+	r := &mockExecutor{}
+	if err := cfg.Process(m, m, r); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if len(m.posted) != 0 || r.lastCmd != "" {
+		t.Errorf("dryrun should not notify: %v %s", m.posted, r.lastCmd)
+	}
+	s.DryRun = false
+	cfg, _ = processing.Load(to, s)
+	m = &mockExecutor{}
+	if err := cfg.Process(m, m, r); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if fmt.Sprintf("%v", m.posted) != "[https://hooks.example.com/blap]" || r.lastCmd != "notify-send" {
+		t.Errorf("invalid notifications: %v %s", m.posted, r.lastCmd)
+	}
+	var n processing.Notification
+	if err := json.Unmarshal(m.payload, &n); err != nil || len(n.Changes) != 2 || n.Changes[0].Name != "abc" || len(n.Errors) != 0 {
+		t.Errorf("invalid payload: %s %v", string(m.payload), err)
+	}
+	if string(r.input) != string(m.payload) {
+		t.Errorf("command should receive payload: %s", string(r.input))
+	}
+	cfg, _ = processing.Load(to, s)
+	m = &mockExecutor{static: true, err: errors.New("failure"), postErr: errors.New("bad hook")}
+	err := cfg.Process(m, m, r)
+	if err == nil || !strings.Contains(err.Error(), "notification failed: https://hooks.example.com/blap: bad hook") {
+		t.Errorf("invalid error: %v", err)
+	}
+	if err := json.Unmarshal(m.payload, &n); err != nil || len(n.Changes) != 0 || !slices.Contains(n.Errors, "application 'nvim' error: failure") {
+		t.Errorf("invalid payload: %s %v", string(m.payload), err)
+	}
+	hooks := strings.ReplaceAll(strings.ReplaceAll(string(b), "#[[hooks.", "[[hooks."), "#commands", "commands")
+	os.WriteFile(to, []byte(hooks), 0o644)
+	cfg, _ = processing.Load(to, s)
+	m = &mockExecutor{}
+	r = &mockExecutor{failOn: "sh"}
+	if err := cfg.Process(m, m, r); err == nil || !strings.Contains(err.Error(), "post update hook failed: sh failed") {
+		t.Errorf("invalid error: %v", err)
+	}
+	if err := json.Unmarshal(m.payload, &n); err != nil || len(n.Changes) != 2 || !slices.Contains(n.Errors, "post update hook failed: sh failed") {
+		t.Errorf("post hook failures should be notified: %s %v", string(m.payload), err)
+	}
+	if r.lastCmd != "notify-send" {
+		t.Errorf("notification should be last: %s", r.lastCmd)
+	}
+	os.WriteFile(to, b, 0o644)
+	s.Offline = true
+	cfg, _ = processing.Load(to, s)
+	m = &mockExecutor{}
+	r = &mockExecutor{}
+	if err := cfg.Process(m, m, r); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if len(m.posted) != 0 || r.lastCmd != "notify-send" {
+		t.Errorf("offline should only run the command: %v %s", m.posted, r.lastCmd)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	os.Mkdir("testdata", 0o755)
+	defer func() {
+		os.RemoveAll("testdata")
+	}()
+	b, _ := os.ReadFile(filepath.Join("examples", "config.toml"))
+	data := strings.ReplaceAll(strings.ReplaceAll(string(b), "#[[hooks.", "[[hooks."), "#commands", "commands")
+	data = strings.ReplaceAll(data, "command = [\"notify-send\"]", "command = []")
+	to := filepath.Join("testdata", "config.toml")
+	os.WriteFile(filepath.Join("testdata", "test.toml"), []byte{}, 0o644)
+	os.WriteFile(to, []byte(data), 0o644)
+	s := cli.Settings{}
+	s.DryRun = true
+	cfg, err := processing.Load(to, s)
+	if err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if len(cfg.Hooks.PreUpgrade) != 1 || len(cfg.Hooks.PostUpgrade) != 1 || len(cfg.Hooks.PrePurge) != 0 {
+		t.Errorf("invalid hooks: %v", cfg.Hooks)
+	}
+	m := &mockExecutor{}
+	r := &mockExecutor{}
+	if err := cfg.Process(m, m, r); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if r.lastCmd != "" {
+		t.Errorf("dryrun should not run hooks: %s", r.lastCmd)
+	}
+	s.DryRun = false
+	cfg, _ = processing.Load(to, s)
+	if err := cfg.Process(m, m, r); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if r.lastCmd != "sh" {
+		t.Errorf("invalid hook: %s", r.lastCmd)
+	}
+	for _, expect := range []string{
+		"BLAP_MODE=update",
+		"BLAP_CHANGED=abc xyz",
+		"BLAP_CHANGED_TAGS=abc=1 details xyz=other",
+		fmt.Sprintf("BLAP_CHANGED_DIRS=%s%c%s", filepath.Join("testdata", "abc"), os.PathListSeparator, filepath.Join("testdata", "xyz")),
+	} {
+		if !slices.Contains(r.lastEnv, expect) {
+			t.Errorf("missing hook environment: %s (%v)", expect, r.lastEnv)
+		}
+	}
+	cfg, _ = processing.Load(to, s)
+	m = &mockExecutor{changes: []processing.Change{{Name: "abc", Details: "$HOME"}}}
+	if err := cfg.Process(m, m, r); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if !slices.Contains(r.lastEnv, "BLAP_CHANGED_TAGS=abc=$HOME") {
+		t.Errorf("hook environment should be literal: %v", r.lastEnv)
+	}
+	cfg, _ = processing.Load(to, s)
+	m = &mockExecutor{static: true}
+	r = &mockExecutor{}
+	if err := cfg.Process(m, m, r); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if r.lastCmd != "sh" || !slices.Contains(r.lastEnv, "BLAP_CHANGED=") {
+		t.Errorf("post hooks should run without changes: %s %v", r.lastCmd, r.lastEnv)
+	}
+	cfg, _ = processing.Load(to, s)
+	m = &mockExecutor{}
+	r = &mockExecutor{err: errors.New("bad hook")}
+	if err := cfg.Process(m, m, r); err == nil || err.Error() != "pre update hook failed: bad hook" {
+		t.Errorf("invalid error: %v", err)
+	}
+	if m.calledDo != 0 {
+		t.Error("applications should not process after a failed pre hook")
+	}
+	s.Purge = true
+	cfg, _ = processing.Load(to, s)
+	cfg.Hooks.PostPurge = cfg.Hooks.PostUpgrade
+	m = &mockExecutor{changes: []processing.Change{{Name: "abc", Details: filepath.Join("testdata", "abc", "1.abc.1")}}}
+	r = &mockExecutor{}
+	if err := cfg.Process(m, m, r); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if !slices.Contains(r.lastEnv, "BLAP_MODE=purge") || !slices.Contains(r.lastEnv, "BLAP_PURGED="+filepath.Join("testdata", "abc", "1.abc.1")) {
+		t.Errorf("missing purge hook environment: %v", r.lastEnv)
+	}
+	for _, e := range r.lastEnv {
+		if strings.HasPrefix(e, "BLAP_CHANGED_TAGS=") {
+			t.Errorf("tags should not be set when purging: %v", r.lastEnv)
+		}
+	}
+}
+
+func TestOffline(t *testing.T) {
+	os.Mkdir("testdata", 0o755)
+	defer func() {
+		os.RemoveAll("testdata")
+	}()
+	to := filepath.Join("testdata", "config.toml")
+	os.WriteFile(to, []byte(`directory = "testdata"
+[apps.abc]
+extract = { skip = true }
+[apps.abc.static]
+url = "https://example.com/abc.tar.gz"
+tag = "1"
+`), 0o644)
+	rsrc := &core.Resource{File: "abc.tar.gz", URL: "https://example.com/abc.tar.gz", Tag: "1"}
+	cfg, _ := processing.Load(to, cli.Settings{})
+	if err := cfg.Process(cfg, &mockExecutor{dl: true, rsrc: rsrc}, &mockExecutor{}); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	archive := *rsrc
+	archive.SetAppData("abc", filepath.Join("testdata", "abc"), core.Extraction{})
+	os.WriteFile(archive.Paths.Archive, []byte{}, 0o644)
+	s := cli.Settings{}
+	s.Offline = true
+	s.Verbosity = cli.InfoVerbosity
+	var buf bytes.Buffer
+	s.Writer = &buf
+	offline := &mockExecutor{procErr: errors.New("offline, no cached response for: https://example.com/abc.tar.gz")}
+	cfg, _ = processing.Load(to, s)
+	if err := cfg.Process(cfg, offline, &mockExecutor{}); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "offline, using existing archive: abc (1)") {
+		t.Errorf("invalid output: %s", buf.String())
+	}
+	os.Remove(archive.Paths.Archive)
+	cfg, _ = processing.Load(to, s)
+	if err := cfg.Process(cfg, offline, &mockExecutor{}); err == nil || err.Error() != "application 'abc' error: offline, no cached data or existing archive: offline, no cached response for: https://example.com/abc.tar.gz" {
+		t.Errorf("invalid error: %v", err)
+	}
+	os.RemoveAll(filepath.Join("testdata", "abc"))
+	cfg, _ = processing.Load(to, s)
+	if err := cfg.Process(cfg, offline, &mockExecutor{}); err == nil || !strings.Contains(err.Error(), "offline, no cached data or existing archive") {
+		t.Errorf("invalid error: %v", err)
+	}
+	legacy := filepath.Join("testdata", "abc", "abcdef1.abc.2")
+	os.MkdirAll(legacy, 0o755)
+	os.WriteFile(filepath.Join(legacy, ".blap_installed"), []byte("2"), 0o644)
+	os.MkdirAll(filepath.Join("testdata", "abc", "fedcba9.abc.0"), 0o755)
+	os.WriteFile(filepath.Join("testdata", "abc", "abcdef1.abc.tar.gz"), []byte{}, 0o644)
+	os.WriteFile(filepath.Join("testdata", "abc", "abcdef1.abc.tar.gz.partial"), []byte{}, 0o644)
+	for range 2 {
+		buf.Reset()
+		cfg, _ = processing.Load(to, s)
+		if err := cfg.Process(cfg, offline, &mockExecutor{}); err != nil {
+			t.Errorf("invalid error: %v", err)
+		}
+		if !strings.Contains(buf.String(), "offline, using existing archive: abc (2)") {
+			t.Errorf("invalid output: %s", buf.String())
+		}
+	}
+	if b, _ := os.ReadFile(filepath.Join("testdata", "abc", ".blap_resource")); !strings.Contains(string(b), `"archive":"abcdef1.abc.tar.gz","unpack":"abcdef1.abc.2"`) {
+		t.Errorf("invalid resource data: %s", string(b))
+	}
+}
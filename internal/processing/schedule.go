@@ -0,0 +1,212 @@
+// Package processing handles scheduling applications by dependencies
+package processing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/seanenck/blap/internal/core"
+)
+
+const (
+	pendingState scheduleState = iota
+	runningState
+	doneState
+	failedState
+)
+
+type (
+	scheduleState int
+	schedule      struct {
+		names   []string
+		apps    map[string]Context
+		depends map[string][]string
+		after   map[string][]string
+	}
+	scheduleResult struct {
+		name string
+		err  error
+	}
+)
+
+// checkDependencies will validate application dependencies (unknown applications and cycles)
+func checkDependencies(apps core.AppSet, defined func(string) bool) error {
+	var names []string
+	for n := range apps {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		app := apps[n]
+		for _, d := range app.Depends {
+			if !defined(d) {
+				return fmt.Errorf("unknown dependency for %s: %s", n, d)
+			}
+			dep, ok := apps[d]
+			if ok && dep.Priority < app.Priority {
+				return fmt.Errorf("%s depends on %s which has a lower priority", n, d)
+			}
+		}
+	}
+	visited := make(map[string]bool)
+	var visit func(string, []string) error
+	visit = func(name string, path []string) error {
+		if idx := slices.Index(path, name); idx >= 0 {
+			return fmt.Errorf("dependency cycle detected: %s", strings.Join(append(path[idx:], name), " -> "))
+		}
+		if visited[name] {
+			return nil
+		}
+		app, ok := apps[name]
+		if !ok {
+			return nil
+		}
+		path = append(path, name)
+		for _, d := range app.Depends {
+			if err := visit(d, path); err != nil {
+				return err
+			}
+		}
+		visited[name] = true
+		return nil
+	}
+	for _, n := range names {
+		if err := visit(n, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newSchedule(apps []Context) *schedule {
+	s := &schedule{
+		apps:    make(map[string]Context),
+		depends: make(map[string][]string),
+		after:   make(map[string][]string),
+	}
+	for _, a := range apps {
+		s.apps[a.Name] = a
+		s.names = append(s.names, a.Name)
+	}
+	sort.Strings(s.names)
+	for _, a := range apps {
+		for _, d := range a.Application.Depends {
+			if _, ok := s.apps[d]; ok {
+				s.depends[a.Name] = append(s.depends[a.Name], d)
+			}
+		}
+		for _, o := range apps {
+			if o.Application.Priority > a.Application.Priority {
+				s.after[a.Name] = append(s.after[a.Name], o.Name)
+			}
+		}
+	}
+	return s
+}
+
+// unscheduled calls the function for dependencies that are not scheduled (disabled, filtered, not indexed)
+func (s *schedule) unscheduled(fxn func(string, string)) {
+	for _, name := range s.names {
+		for _, d := range s.apps[name].Application.Depends {
+			if _, ok := s.apps[d]; !ok {
+				fxn(name, d)
+			}
+		}
+	}
+}
+
+func (s *schedule) check(name string, state map[string]scheduleState) (bool, string) {
+	blocked := false
+	for _, d := range s.depends[name] {
+		switch state[d] {
+		case failedState:
+			return false, d
+		case doneState:
+		default:
+			blocked = true
+		}
+	}
+	for _, a := range s.after[name] {
+		switch state[a] {
+		case doneState, failedState:
+		default:
+			blocked = true
+		}
+	}
+	return blocked, ""
+}
+
+func (s *schedule) run(ctx context.Context, limit int, fxn func(Context) error) ([]error, error) {
+	limit = max(limit, 1)
+	state := make(map[string]scheduleState)
+	results := make(chan scheduleResult, len(s.names))
+	var errs []error
+	var aborted []string
+	running := 0
+	for {
+		progressed := ctx.Err() == nil
+		for progressed {
+			progressed = false
+			for _, name := range s.names {
+				if state[name] != pendingState {
+					continue
+				}
+				blocked, failed := s.check(name, state)
+				if failed != "" {
+					state[name] = failedState
+					errs = append(errs, fmt.Errorf("application '%s' skipped, dependency failed: %s", name, failed))
+					progressed = true
+					continue
+				}
+				if blocked || running >= limit {
+					continue
+				}
+				state[name] = runningState
+				running++
+				go func(app Context) {
+					results <- scheduleResult{app.Name, fxn(app)}
+				}(s.apps[name])
+			}
+		}
+		if running == 0 {
+			break
+		}
+		r := <-results
+		running--
+		state[r.name] = doneState
+		if r.err != nil {
+			state[r.name] = failedState
+			if ctx.Err() != nil {
+				aborted = append(aborted, r.name)
+				continue
+			}
+			errs = append(errs, fmt.Errorf("application '%s' error: %v", r.name, r.err))
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		for _, name := range s.names {
+			if state[name] == pendingState {
+				aborted = append(aborted, name)
+			}
+		}
+		sort.Strings(aborted)
+		reason := "application processing cancelled"
+		if errors.Is(err, context.DeadlineExceeded) {
+			reason = "timeout reached for application processing"
+		}
+		if len(aborted) > 0 {
+			reason = fmt.Sprintf("%s, aborted: %s", reason, strings.Join(aborted, ", "))
+		}
+		return errs, errors.New(reason)
+	}
+	for _, name := range s.names {
+		if state[name] == pendingState {
+			return errs, fmt.Errorf("unable to schedule application: %s", name)
+		}
+	}
+	return errs, nil
+}
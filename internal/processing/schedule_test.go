@@ -0,0 +1,164 @@
+package processing_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/seanenck/blap/internal/cli"
+	"github.com/seanenck/blap/internal/processing"
+	"github.com/seanenck/blap/internal/steps"
+	"github.com/seanenck/blap/internal/util"
+)
+
+type (
+	orderedExecutor struct {
+		mutex sync.Mutex
+		order []string
+		fail  []string
+		block []string
+	}
+	contextRunner struct {
+		*mockExecutor
+		ctx context.Context
+	}
+)
+
+func (c *contextRunner) WithContext(ctx context.Context) util.Runner {
+	return &contextRunner{c.mockExecutor, ctx}
+}
+
+func (o *orderedExecutor) Do(ctx processing.Context) error {
+	if slices.Contains(o.block, ctx.Name) {
+		<-ctx.Runner.(*contextRunner).ctx.Done()
+		return errors.New("cancelled")
+	}
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.order = append(o.order, ctx.Name)
+	if slices.Contains(o.fail, ctx.Name) {
+		return errors.New("failed")
+	}
+	return nil
+}
+
+func (o *orderedExecutor) Purge(string, []string, steps.OnPurge) error {
+	return nil
+}
+
+func (o *orderedExecutor) Changed() []processing.Change {
+	return nil
+}
+
+func writeDependencyConfig(apps string) string {
+	to := filepath.Join("testdata", "depends.toml")
+	os.WriteFile(to, []byte("directory = \"testdata\"\nparallelization = 4\n"+apps), 0o644)
+	return to
+}
+
+func TestDependencyErrors(t *testing.T) {
+	defer genCleanup()()
+	for apps, expect := range map[string]string{
+		"[apps.a]\ndepends = [\"b\"]\n": "unknown dependency for a: b",
+		"[apps.a]\ndepends = [\"a\"]\n": "dependency cycle detected: a -> a",
+		"[apps.a]\ndepends = [\"b\"]\n[apps.b]\ndepends = [\"c\"]\n[apps.c]\ndepends = [\"a\"]\n": "dependency cycle detected: a -> b -> c -> a",
+		"[apps.a]\ndepends = [\"b\"]\npriority = 1\n[apps.b]\n":                                   "a depends on b which has a lower priority",
+	} {
+		if _, err := processing.Load(writeDependencyConfig(apps), cli.Settings{}); err == nil || err.Error() != expect {
+			t.Errorf("invalid error: %v (expected: %s)", err, expect)
+		}
+	}
+	if _, err := processing.Load(writeDependencyConfig("[apps.a]\ndepends = [\"b\"]\n[apps.b]\nflags = [\"disabled\"]\n"), cli.Settings{}); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+}
+
+func TestDependencyOrder(t *testing.T) {
+	defer genCleanup()()
+	s := cli.Settings{}
+	cfg, err := processing.Load(writeDependencyConfig("[apps.a]\ndepends = [\"b\", \"c\"]\n[apps.b]\ndepends = [\"c\"]\n[apps.c]\n[apps.d]\npriority = -1\n"), s)
+	if err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	o := &orderedExecutor{}
+	m := &mockExecutor{}
+	cfg.Builds = -1
+	if err := cfg.Process(o, m, m); err == nil || err.Error() != "builds must be >= 0 (have: -1)" {
+		t.Errorf("invalid error: %v", err)
+	}
+	cfg.Builds = 2
+	if err := cfg.Process(o, m, m); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if strings.Join(o.order, ",") != "c,b,a,d" {
+		t.Errorf("invalid order: %v", o.order)
+	}
+	o = &orderedExecutor{fail: []string{"c"}}
+	err = cfg.Process(o, m, m)
+	if err == nil {
+		t.Error("expected errors")
+	} else {
+		str := err.Error()
+		for _, need := range []string{"application 'c' error: failed", "application 'b' skipped, dependency failed: c", "application 'a' skipped, dependency failed: c"} {
+			if !strings.Contains(str, need) {
+				t.Errorf("invalid error: %v", err)
+			}
+		}
+	}
+	if strings.Join(o.order, ",") != "c,d" {
+		t.Errorf("invalid order: %v", o.order)
+	}
+	var buf bytes.Buffer
+	s.Writer = &buf
+	s.Verbosity = cli.InfoVerbosity
+	s.CompileApplicationFilters(nil, []string{"a"}, false)
+	cfg, _ = processing.Load(writeDependencyConfig("[apps.a]\ndepends = [\"b\"]\n[apps.b]\n"), s)
+	o = &orderedExecutor{fail: []string{"b"}}
+	if err := cfg.Process(o, m, m); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if strings.Join(o.order, ",") != "a" {
+		t.Errorf("invalid order: %v", o.order)
+	}
+	if !strings.Contains(buf.String(), "warning: a depends on b which is not processed (filtered), ordering is ignored") {
+		t.Errorf("invalid warning: %s", buf.String())
+	}
+	buf.Reset()
+	cfg, _ = processing.Load(writeDependencyConfig("[apps.a]\ndepends = [\"b\"]\n[apps.b]\nflags = [\"disabled\"]\n"), s)
+	if err := cfg.Process(o, m, m); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "warning: a depends on b which is not processed (disabled), ordering is ignored") {
+		t.Errorf("invalid warning: %s", buf.String())
+	}
+}
+
+func TestDependencyCancel(t *testing.T) {
+	defer genCleanup()()
+	cfg, err := processing.Load(writeDependencyConfig("[connections.timeouts]\nall = 1\n[apps.a]\n[apps.b]\ndepends = [\"a\"]\n[apps.c]\n[apps.d]\nflags = [\"disabled\"]\n"), cli.Settings{})
+	if err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	o := &orderedExecutor{block: []string{"a"}, fail: []string{"c"}}
+	m := &mockExecutor{}
+	err = cfg.Process(o, m, &contextRunner{mockExecutor: m})
+	if err == nil {
+		t.Error("expected errors")
+	} else {
+		str := err.Error()
+		for _, need := range []string{"application 'c' error: failed", "timeout reached for application processing, aborted: a, b"} {
+			if !strings.Contains(str, need) {
+				t.Errorf("invalid error: %v", err)
+			}
+		}
+	}
+	if strings.Join(o.order, ",") != "c" {
+		t.Errorf("invalid order: %v", o.order)
+	}
+}
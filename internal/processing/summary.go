@@ -0,0 +1,346 @@
+// Package processing handles the run summary report
+package processing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/seanenck/blap/internal/core"
+	"github.com/seanenck/blap/internal/steps"
+)
+
+const (
+	// MarkdownSummary writes the summary report as markdown (default)
+	MarkdownSummary = "markdown"
+	// JSONSummary writes the summary report as json
+	JSONSummary = "json"
+
+	fetchPhase    = "fetch"
+	downloadPhase = "download"
+	extractPhase  = "extract"
+	buildPhase    = "build"
+)
+
+var summaryPhases = []string{fetchPhase, downloadPhase, extractPhase, buildPhase}
+
+type (
+	// Summary is the report of a processing run
+	Summary struct {
+		Mode       string           `json:"mode"`
+		DryRun     bool             `json:"dryrun"`
+		Changed    []SummaryChange  `json:"changed"`
+		Current    []string         `json:"current"`
+		Skipped    []SummarySkip    `json:"skipped"`
+		Failed     []SummaryFailure `json:"failed"`
+		Downloaded int64            `json:"downloaded"`
+		Phases     []SummaryPhase   `json:"phases"`
+		Elapsed    float64          `json:"elapsed"`
+	}
+	// SummaryChange is an updated/purged application
+	SummaryChange struct {
+		Name string `json:"name"`
+		From string `json:"from,omitempty"`
+		To   string `json:"to"`
+	}
+	// SummarySkip is an application that was not processed
+	SummarySkip struct {
+		Name   string `json:"name"`
+		Reason string `json:"reason"`
+	}
+	// SummaryFailure is an application that failed processing
+	SummaryFailure struct {
+		Name  string `json:"name"`
+		Error string `json:"error"`
+	}
+	// SummaryPhase is the (cumulative, across applications) time spent in a phase
+	SummaryPhase struct {
+		Name    string  `json:"name"`
+		Seconds float64 `json:"seconds"`
+	}
+	runSummary struct {
+		lock       sync.Mutex
+		started    time.Time
+		previous   map[string]string
+		tags       map[string]string
+		installed  map[string]string
+		durations  map[string]time.Duration
+		processed  []string
+		failed     map[string]string
+		skipped    map[string]string
+		downloaded int64
+		phases     map[string]time.Duration
+	}
+)
+
+func newRunSummary(skipped map[string]string) *runSummary {
+	s := &runSummary{
+		started:   time.Now(),
+		previous:  make(map[string]string),
+		tags:      make(map[string]string),
+		installed: make(map[string]string),
+		durations: make(map[string]time.Duration),
+		failed:    make(map[string]string),
+		skipped:   make(map[string]string),
+		phases:    make(map[string]time.Duration),
+	}
+	for k, v := range skipped {
+		s.skipped[k] = v
+	}
+	return s
+}
+
+func (s *runSummary) phase(name string, start time.Time) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.phases[name] += time.Since(start)
+}
+
+func (s *runSummary) tag(name, tag string) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.tags[name] = tag
+}
+
+func (s *runSummary) deployed(name, tag string) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.installed[name] = tag
+}
+
+func (s *runSummary) download(name, previous string, size int64) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if previous != "" {
+		s.previous[name] = previous
+	}
+	s.downloaded += size
+}
+
+func (s *runSummary) skip(name, reason string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.skipped[name] = reason
+}
+
+func (s *runSummary) skippedReason(name string) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.skipped[name]
+}
+
+func (s *runSummary) result(name string, duration time.Duration, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.durations[name] = duration
+	if err == nil {
+		s.processed = append(s.processed, name)
+		return
+	}
+	msg, _, _ := strings.Cut(err.Error(), "\n")
+	s.failed[name] = msg
+}
+
+func (s *runSummary) report(mode string, dryrun bool, changed []Change) Summary {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	res := Summary{Mode: mode, DryRun: dryrun, Downloaded: s.downloaded}
+	var names []string
+	for _, c := range changed {
+		res.Changed = append(res.Changed, SummaryChange{Name: c.Name, From: s.previous[c.Name], To: c.Details})
+		names = append(names, c.Name)
+	}
+	slices.SortFunc(res.Changed, func(a, b SummaryChange) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	for _, name := range s.processed {
+		if !slices.Contains(names, name) {
+			res.Current = append(res.Current, name)
+		}
+	}
+	slices.Sort(res.Current)
+	for name, reason := range s.skipped {
+		res.Skipped = append(res.Skipped, SummarySkip{Name: name, Reason: reason})
+	}
+	slices.SortFunc(res.Skipped, func(a, b SummarySkip) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	for name, msg := range s.failed {
+		res.Failed = append(res.Failed, SummaryFailure{Name: name, Error: msg})
+	}
+	slices.SortFunc(res.Failed, func(a, b SummaryFailure) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	for _, p := range summaryPhases {
+		res.Phases = append(res.Phases, SummaryPhase{Name: p, Seconds: s.phases[p].Seconds()})
+	}
+	res.Elapsed = time.Since(s.started).Seconds()
+	return res
+}
+
+func (s Summary) rows() [][]string {
+	status := "updated"
+	if s.Mode == "purge" {
+		status = "purged"
+	}
+	var rows [][]string
+	for _, c := range s.Changed {
+		detail := c.To
+		if c.From != "" {
+			detail = fmt.Sprintf("%s -> %s", c.From, c.To)
+		}
+		rows = append(rows, []string{status, c.Name, detail})
+	}
+	for _, name := range s.Current {
+		rows = append(rows, []string{"current", name, ""})
+	}
+	for _, skip := range s.Skipped {
+		rows = append(rows, []string{"skipped", skip.Name, skip.Reason})
+	}
+	for _, f := range s.Failed {
+		rows = append(rows, []string{"failed", f.Name, f.Error})
+	}
+	return rows
+}
+
+func (s Summary) totals() (string, string) {
+	var phases []string
+	for _, p := range s.Phases {
+		phases = append(phases, fmt.Sprintf("%s: %s", p.Name, seconds(p.Seconds)))
+	}
+	downloaded := fmt.Sprintf("%.1f MiB", float64(s.Downloaded)/(1024*1024))
+	elapsed := fmt.Sprintf("%s (%s)", seconds(s.Elapsed), strings.Join(phases, ", "))
+	return downloaded, elapsed
+}
+
+func seconds(s float64) string {
+	return (time.Duration(s * float64(time.Second))).Round(time.Millisecond).String()
+}
+
+// Write will write the summary as a table
+func (s Summary) Write(w io.Writer) error {
+	if w == nil {
+		return errors.New("nil writer")
+	}
+	fmt.Fprintf(w, "\nsummary (%s, dryrun: %v)\n", s.Mode, s.DryRun)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "  status\tapplication\tdetails")
+	for _, row := range s.rows() {
+		fmt.Fprintf(tw, "  %s\n", strings.Join(row, "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	downloaded, elapsed := s.totals()
+	fmt.Fprintf(w, "  downloaded: %s\n  elapsed: %s\n", downloaded, elapsed)
+	return nil
+}
+
+// WriteMarkdown will write the summary as markdown
+func (s Summary) WriteMarkdown(w io.Writer) error {
+	if w == nil {
+		return errors.New("nil writer")
+	}
+	fmt.Fprintf(w, "# blap %s summary\n\n", s.Mode)
+	fmt.Fprintf(w, "- dryrun: %v\n", s.DryRun)
+	downloaded, elapsed := s.totals()
+	fmt.Fprintf(w, "- downloaded: %s\n- elapsed: %s\n\n", downloaded, elapsed)
+	fmt.Fprintln(w, "| status | application | details |")
+	fmt.Fprintln(w, "| --- | --- | --- |")
+	for _, row := range s.rows() {
+		for idx := range row {
+			row[idx] = strings.ReplaceAll(row[idx], "|", "\\|")
+		}
+		fmt.Fprintf(w, "| %s |\n", strings.Join(row, " | "))
+	}
+	return nil
+}
+
+func (c Configuration) writeSummary(s Summary) error {
+	if c.context.Writer != nil && c.context.Verbosity > 0 {
+		processLock.Lock()
+		err := s.Write(c.context.Writer)
+		processLock.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	file := c.Summary.File.String()
+	if file == "" {
+		return nil
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if c.Summary.Format == JSONSummary {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	}
+	return s.WriteMarkdown(f)
+}
+
+func checkSummaryFormat(format string) error {
+	switch format {
+	case "", MarkdownSummary, JSONSummary:
+		return nil
+	}
+	return fmt.Errorf("unknown summary format: %s", format)
+}
+
+func skipReason(flags core.FlagSet) string {
+	switch {
+	case flags.Pin():
+		return "pinned"
+	case flags.Skipped():
+		return "disabled"
+	}
+	return "platform"
+}
+
+func previousTag(dir, current string) string {
+	markers, err := filepath.Glob(filepath.Join(dir, "*", filepath.Base(steps.Directories{}.Installed())))
+	if err != nil {
+		return ""
+	}
+	var newest time.Time
+	tag := ""
+	for _, m := range markers {
+		if filepath.Dir(m) == current {
+			continue
+		}
+		info, err := os.Stat(m)
+		if err != nil || info.ModTime().Before(newest) {
+			continue
+		}
+		b, err := os.ReadFile(m)
+		if err != nil {
+			continue
+		}
+		newest = info.ModTime()
+		tag = strings.TrimSpace(string(b))
+	}
+	return tag
+}
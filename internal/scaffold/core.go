@@ -0,0 +1,139 @@
+// Package scaffold generates application definitions from upstream sources
+package scaffold
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/BurntSushi/toml"
+	"github.com/seanenck/blap/internal/util"
+)
+
+const (
+	gitHubMode = "github"
+	gitMode    = "git"
+	webMode    = "web"
+)
+
+var (
+	bareKey    = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	definition = template.Must(template.New("app").Funcs(template.FuncMap{
+		"quote": quote,
+	}).Parse(`
+# generated from: {{ .Source }}{{ if .Tag }} (latest: {{ .Tag }}){{ end }}
+{{- range .Notes }}
+# {{ . }}
+{{- end }}
+{{- if eq .Mode "github" }}
+[apps.{{ .Key }}.github]
+project = {{ quote .Project }}
+release = { asset = {{ quote .Asset }} }
+{{- else if eq .Mode "git" }}
+[apps.{{ .Key }}.git]
+repository = {{ quote .Repository }}
+tagged.download = {{ quote .Download }}
+tagged.filters = [
+{{- range .Filters }}
+  {{ quote . }},
+{{- end }}
+]
+{{- else if eq .Mode "web" }}
+[apps.{{ .Key }}.web]
+url = {{ quote .URL }}
+scrape.download = {{ quote .Download }}
+scrape.filters = [
+{{- range .Filters }}
+  {{ quote . }},
+{{- end }}
+]
+scrape.sort = {{ quote .Sort }}
+{{- end }}
+{{- if .SkipExtract }}
+[apps.{{ .Key }}.extract]
+skip = true
+{{- else }}
+# [[apps.{{ .Key }}.setup]]
+# commands = ["ln", "-sf", "bin/{{ .Name }}", "~/.local/bin"]
+{{- end }}
+`))
+)
+
+type (
+	// Definition is a generated application definition
+	Definition struct {
+		Name        string
+		Source      string
+		Mode        string
+		Tag         string
+		Project     string
+		Asset       string
+		Repository  string
+		URL         string
+		Download    string
+		Filters     []string
+		Sort        string
+		SkipExtract bool
+		Notes       []string
+	}
+)
+
+// Key is the (toml) application key for the definition
+func (d Definition) Key() string {
+	if bareKey.MatchString(d.Name) {
+		return d.Name
+	}
+	return quote(d.Name)
+}
+
+// Write will write the definition as a configuration block
+func (d Definition) Write(w io.Writer) error {
+	if w == nil {
+		return errors.New("nil writer")
+	}
+	if d.Name == "" {
+		return errors.New("name is required")
+	}
+	switch d.Mode {
+	case gitHubMode, gitMode, webMode:
+	default:
+		return fmt.Errorf("unknown mode: %s", d.Mode)
+	}
+	return definition.Execute(w, d)
+}
+
+// Append will add the definition to an (include) file
+func (d Definition) Append(file string) error {
+	if file == "" {
+		return errors.New("file is required")
+	}
+	if util.PathExists(file) {
+		var existing struct {
+			Apps map[string]any
+		}
+		if _, err := toml.DecodeFile(file, &existing); err != nil {
+			return err
+		}
+		if _, ok := existing.Apps[d.Name]; ok {
+			return fmt.Errorf("%s is already defined in: %s", d.Name, file)
+		}
+	}
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return d.Write(f)
+}
+
+func quote(in string) string {
+	if !strings.ContainsAny(in, "'\n") {
+		return fmt.Sprintf("'%s'", in)
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return fmt.Sprintf(`"%s"`, r.Replace(in))
+}
@@ -0,0 +1,82 @@
+package scaffold_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/seanenck/blap/internal/scaffold"
+)
+
+func TestWriteErrors(t *testing.T) {
+	d := scaffold.Definition{}
+	if err := d.Write(nil); err == nil || err.Error() != "nil writer" {
+		t.Errorf("invalid error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := d.Write(&buf); err == nil || err.Error() != "name is required" {
+		t.Errorf("invalid error: %v", err)
+	}
+	d.Name = "abc"
+	if err := d.Write(&buf); err == nil || err.Error() != "unknown mode: " {
+		t.Errorf("invalid error: %v", err)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	d := scaffold.Definition{Name: "a.b", Mode: "github", Project: "x/y", Asset: `x-(.+?)\.tar\.gz$`, Tag: "v1", Source: "src"}
+	var buf bytes.Buffer
+	if err := d.Write(&buf); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	s := buf.String()
+	if !strings.Contains(s, `[apps.'a.b'.github]`) || !strings.Contains(s, `release = { asset = 'x-(.+?)\.tar\.gz$' }`) || !strings.Contains(s, "(latest: v1)") {
+		t.Errorf("invalid definition: %s", s)
+	}
+	var obj map[string]any
+	if _, err := toml.Decode(s, &obj); err != nil {
+		t.Errorf("invalid toml: %v", err)
+	}
+	d = scaffold.Definition{Name: "abc", Mode: "web", URL: "u", Download: "d", Filters: []string{"it's"}, Sort: "semver", SkipExtract: true}
+	buf = bytes.Buffer{}
+	if err := d.Write(&buf); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	s = buf.String()
+	if !strings.Contains(s, `"it's",`) || !strings.Contains(s, "[apps.abc.extract]") {
+		t.Errorf("invalid definition: %s", s)
+	}
+	if _, err := toml.Decode(s, &obj); err != nil {
+		t.Errorf("invalid toml: %v", err)
+	}
+}
+
+func TestAppend(t *testing.T) {
+	os.RemoveAll("testdata")
+	os.Mkdir("testdata", 0o755)
+	defer os.RemoveAll("testdata")
+	d := scaffold.Definition{Name: "abc", Mode: "git", Repository: "r", Download: "d", Filters: []string{"f"}}
+	if err := d.Append(""); err == nil || err.Error() != "file is required" {
+		t.Errorf("invalid error: %v", err)
+	}
+	file := filepath.Join("testdata", "include.toml")
+	if err := d.Append(file); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if err := d.Append(file); err == nil || err.Error() != "abc is already defined in: testdata/include.toml" {
+		t.Errorf("invalid error: %v", err)
+	}
+	d.Name = "xyz"
+	if err := d.Append(file); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	var obj struct {
+		Apps map[string]any
+	}
+	if _, err := toml.DecodeFile(file, &obj); err != nil || len(obj.Apps) != 2 {
+		t.Errorf("invalid include: %v %v", err, obj)
+	}
+}
@@ -0,0 +1,375 @@
+// Package scaffold detects upstream sources and their latest releases
+package scaffold
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/seanenck/blap/internal/core"
+	"github.com/seanenck/blap/internal/fetch"
+	"github.com/seanenck/blap/internal/logging"
+	"github.com/seanenck/blap/internal/util"
+	"golang.org/x/mod/semver"
+)
+
+const (
+	tagTemplate  = "{{ $.Vars.Tag }}"
+	fullTemplate = "{{ $.Vars.Tag.Full }}"
+	osTemplate   = "{{ $.OS }}"
+	archTemplate = "{{ $.Arch }}"
+)
+
+var (
+	digits      = regexp.MustCompile(`[0-9]+`)
+	versioned   = regexp.MustCompile(`[0-9]+(\.[0-9]+)+`)
+	hrefs       = regexp.MustCompile(`href=["']([^"']+)["']`)
+	osAliases   = map[string][]string{"darwin": {"darwin", "macos", "apple"}}
+	archAliases = map[string][]string{
+		"amd64": {"amd64", "x86_64", "x64"},
+		"arm64": {"arm64", "aarch64"},
+	}
+	ignoredSuffixes = []string{".sha256", ".sha256sum", ".sha512", ".sha512sum", ".md5", ".asc", ".sig", ".sbom", ".pem", ".txt", ".json", ".deb", ".rpm", ".apk", ".msi", ".dmg", ".pkg"}
+)
+
+// Generate will detect the source type of an upstream and generate a definition
+func Generate(r fetch.Retriever, source, name string) (Definition, error) {
+	source = strings.TrimSpace(source)
+	if source == "" {
+		return Definition{}, errors.New("source url is required")
+	}
+	if r == nil {
+		return Definition{}, errors.New("retriever is required")
+	}
+	d := Definition{Source: source, Name: name}
+	isGit := strings.HasPrefix(source, "git@") || strings.HasSuffix(source, ".git")
+	u, err := url.Parse(hostedSource(source))
+	if err != nil && !isGit {
+		return d, err
+	}
+	if d.Name == "" {
+		d.Name = defaultName(source)
+	}
+	if d.Name == "" {
+		return d, errors.New("unable to determine name, please provide one")
+	}
+	if u != nil {
+		switch u.Scheme {
+		case "ssh", "git":
+			isGit = true
+		}
+		project := strings.Trim(strings.TrimSuffix(u.Path, ".git"), "/")
+		switch {
+		case u.Host == "github.com":
+			parts := strings.Split(project, "/")
+			if len(parts) < 2 {
+				return d, fmt.Errorf("invalid github project: %s", project)
+			}
+			return d, d.gitHub(r, strings.Join(parts[0:2], "/"))
+		case strings.Contains(u.Host, "gitlab"):
+			return d, d.gitLab(r, u, project)
+		}
+	}
+	if isGit {
+		return d, d.git(r)
+	}
+	return d, d.web(r, u)
+}
+
+// hostedSource converts ssh (github/gitlab) sources to https for detection (e.g. git@github.com:owner/repo)
+func hostedSource(source string) string {
+	host, project, ok := "", "", false
+	if rest, found := strings.CutPrefix(source, "ssh://"); found {
+		_, rest, _ = strings.Cut(rest, "@")
+		host, project, ok = strings.Cut(rest, "/")
+	} else if rest, found := strings.CutPrefix(source, "git@"); found {
+		host, project, ok = strings.Cut(rest, ":")
+	}
+	if !ok || (host != "github.com" && !strings.Contains(host, "gitlab")) {
+		return source
+	}
+	return fmt.Sprintf("https://%s/%s", host, strings.TrimPrefix(project, "/"))
+}
+
+func defaultName(source string) string {
+	base := path.Base(strings.TrimSuffix(strings.TrimSuffix(source, "/"), ".git"))
+	if idx := strings.LastIndex(base, ":"); idx >= 0 {
+		base = base[idx+1:]
+	}
+	return util.CleanFileName(strings.ToLower(strings.TrimSuffix(base, filepath.Ext(base))))
+}
+
+func (d *Definition) gitHub(r fetch.Retriever, project string) error {
+	type (
+		Release struct {
+			Assets []struct {
+				DownloadURL string `json:"browser_download_url"`
+			} `json:"assets"`
+			Tag string `json:"tag_name"`
+		}
+	)
+	r.Debug(logging.GitHubCategory, "scaffolding github release: %s\n", project)
+	release := Release{}
+	if err := r.GitHubFetch(project, "releases/latest", &release); err != nil {
+		return err
+	}
+	if release.Tag == "" {
+		return errors.New("no release tag found")
+	}
+	d.Mode = gitHubMode
+	d.Project = project
+	d.Tag = release.Tag
+	var assets []string
+	for _, a := range release.Assets {
+		assets = append(assets, filepath.Base(a.DownloadURL))
+	}
+	if len(assets) == 0 {
+		d.Asset = "tarball"
+		d.Notes = append(d.Notes, "no release assets found, using the release tarball")
+		return nil
+	}
+	matched := matchPlatform(assets)
+	if len(matched) == 0 {
+		d.Asset = ".*"
+		d.Notes = append(d.Notes, "no asset matched this platform, select one of:")
+		for _, a := range assets {
+			d.Notes = append(d.Notes, fmt.Sprintf("  -> %s", a))
+		}
+		return nil
+	}
+	chosen := matched[0]
+	d.Asset = assetRegexp(chosen, release.Tag)
+	d.SkipExtract = !core.CanExtract(chosen)
+	d.otherChoices(matched)
+	return nil
+}
+
+func (d *Definition) gitLab(r fetch.Retriever, u *url.URL, project string) error {
+	type (
+		Release struct {
+			Tag    string `json:"tag_name"`
+			Assets struct {
+				Links []struct {
+					Name string `json:"name"`
+					URL  string `json:"direct_asset_url"`
+				} `json:"links"`
+				Sources []struct {
+					Format string `json:"format"`
+					URL    string `json:"url"`
+				} `json:"sources"`
+			} `json:"assets"`
+		}
+	)
+	api := fmt.Sprintf("%s://%s/api/v4/projects/%s/releases/permalink/latest", u.Scheme, u.Host, url.PathEscape(project))
+	r.Debug(logging.FetchCategory, "scaffolding gitlab release: %s\n", api)
+	resp, err := r.Get(api)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unable to get latest gitlab release: %s", resp.Status)
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	release := Release{}
+	if err := json.Unmarshal(b, &release); err != nil {
+		return err
+	}
+	if release.Tag == "" {
+		return errors.New("no release tag found")
+	}
+	d.Mode = gitMode
+	d.Tag = release.Tag
+	d.Repository = fmt.Sprintf("%s://%s/%s.git", u.Scheme, u.Host, project)
+	d.Filters = []string{tagFilter(release.Tag)}
+	var names []string
+	links := make(map[string]string)
+	for _, l := range release.Assets.Links {
+		names = append(names, l.Name)
+		links[l.Name] = l.URL
+	}
+	matched := matchPlatform(names)
+	if len(matched) > 0 {
+		chosen := matched[0]
+		d.Download = templateTag(links[chosen], release.Tag)
+		d.SkipExtract = !core.CanExtract(chosen)
+		d.otherChoices(matched)
+		return nil
+	}
+	for _, s := range release.Assets.Sources {
+		if s.Format == "tar.gz" {
+			d.Download = templateTag(s.URL, release.Tag)
+			d.Notes = append(d.Notes, "no asset matched this platform, using the source archive")
+			return nil
+		}
+	}
+	d.Notes = append(d.Notes, "no asset or source archive found, tagged.download must be set")
+	return nil
+}
+
+func (d *Definition) git(r fetch.Retriever) error {
+	out, err := r.ExecuteCommand("git", "-c", "versionsort.suffix=-", "ls-remote", "--tags", "--sort=-v:refname", d.Source)
+	if err != nil {
+		return err
+	}
+	d.Mode = gitMode
+	d.Repository = d.Source
+	for _, line := range strings.Split(out, "\n") {
+		parts := strings.Split(strings.TrimSpace(line), "\t")
+		if len(parts) != 2 || strings.HasSuffix(parts[1], "^{}") {
+			continue
+		}
+		d.Tag = strings.TrimPrefix(parts[1], "refs/tags/")
+		break
+	}
+	if d.Tag == "" {
+		return errors.New("no tags found")
+	}
+	d.Filters = []string{tagFilter(d.Tag)}
+	d.Notes = append(d.Notes, fmt.Sprintf("tagged.download must be set, use %s for the detected tag", tagTemplate))
+	return nil
+}
+
+func (d *Definition) web(r fetch.Retriever, u *url.URL) error {
+	if u == nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("unable to detect source type: %s", d.Source)
+	}
+	resp, err := r.Get(u.String())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var links []string
+	resolved := make(map[string]string)
+	for _, m := range hrefs.FindAllStringSubmatch(string(b), -1) {
+		base := path.Base(m[1])
+		if !versioned.MatchString(base) || slices.Contains(links, base) {
+			continue
+		}
+		ref, err := u.Parse(m[1])
+		if err != nil {
+			continue
+		}
+		links = append(links, base)
+		resolved[base] = ref.String()
+	}
+	if len(links) == 0 {
+		return errors.New("no versioned links found")
+	}
+	candidates := matchPlatform(links)
+	if len(candidates) == 0 {
+		for _, l := range links {
+			if core.CanExtract(l) {
+				candidates = append(candidates, l)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return errors.New("no downloadable links found")
+	}
+	chosen := candidates[0]
+	for _, c := range candidates {
+		if semver.Compare(linkVersion(c), linkVersion(chosen)) > 0 {
+			chosen = c
+		}
+	}
+	version := versioned.FindString(chosen)
+	idx := strings.Index(chosen, version)
+	d.Mode = webMode
+	d.URL = u.String()
+	d.Tag = version
+	d.Sort = "semver"
+	d.Filters = []string{fmt.Sprintf(`%s([0-9]+(?:\.[0-9]+)+)%s`, regexp.QuoteMeta(chosen[0:idx]), regexp.QuoteMeta(chosen[idx+len(version):]))}
+	d.Download = strings.ReplaceAll(resolved[chosen], version, fullTemplate)
+	d.SkipExtract = !core.CanExtract(chosen)
+	return nil
+}
+
+func (d *Definition) otherChoices(matched []string) {
+	if len(matched) < 2 {
+		return
+	}
+	d.Notes = append(d.Notes, "other assets matched this platform:")
+	for _, m := range matched[1:] {
+		d.Notes = append(d.Notes, fmt.Sprintf("  -> %s", m))
+	}
+}
+
+func linkVersion(link string) string {
+	return fmt.Sprintf("v%s", versioned.FindString(link))
+}
+
+func aliases(set map[string][]string, value string) []string {
+	if a, ok := set[value]; ok {
+		return a
+	}
+	return []string{value}
+}
+
+func matchPlatform(assets []string) []string {
+	var matched []string
+	var archives []string
+	for _, a := range assets {
+		lower := strings.ToLower(a)
+		if slices.ContainsFunc(ignoredSuffixes, func(s string) bool {
+			return strings.HasSuffix(lower, s)
+		}) {
+			continue
+		}
+		has := func(set map[string][]string, value string) bool {
+			return slices.ContainsFunc(aliases(set, value), func(s string) bool {
+				return strings.Contains(lower, s)
+			})
+		}
+		if !has(osAliases, core.BaseTemplate.OS) || !has(archAliases, core.BaseTemplate.Arch) {
+			continue
+		}
+		if core.CanExtract(a) {
+			archives = append(archives, a)
+		} else {
+			matched = append(matched, a)
+		}
+	}
+	return append(archives, matched...)
+}
+
+func assetRegexp(asset, tag string) string {
+	re := regexp.QuoteMeta(asset)
+	version := strings.TrimPrefix(tag, "v")
+	if version != "" {
+		re = strings.ReplaceAll(re, regexp.QuoteMeta(version), "(.+?)")
+	}
+	re = strings.ReplaceAll(re, core.BaseTemplate.OS, osTemplate)
+	re = strings.ReplaceAll(re, core.BaseTemplate.Arch, archTemplate)
+	return fmt.Sprintf("%s$", re)
+}
+
+func tagFilter(tag string) string {
+	return fmt.Sprintf("^%s$", digits.ReplaceAllString(regexp.QuoteMeta(tag), "[0-9]+"))
+}
+
+func templateTag(in, tag string) string {
+	if strings.Contains(in, tag) {
+		return strings.ReplaceAll(in, tag, tagTemplate)
+	}
+	version := strings.TrimPrefix(tag, "v")
+	if version != tag && strings.Contains(in, version) {
+		return strings.ReplaceAll(in, version, fullTemplate)
+	}
+	return in
+}
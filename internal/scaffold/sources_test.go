@@ -0,0 +1,180 @@
+package scaffold_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/seanenck/blap/internal/core"
+	"github.com/seanenck/blap/internal/fetch/retriever"
+	"github.com/seanenck/blap/internal/scaffold"
+)
+
+type mock struct {
+	payload []byte
+	status  int
+	req     *http.Request
+	args    []string
+}
+
+func (m *mock) Do(r *http.Request) (*http.Response, error) {
+	m.req = r
+	resp := &http.Response{}
+	resp.Body = io.NopCloser(bytes.NewBuffer(m.payload))
+	resp.StatusCode = http.StatusOK
+	if m.status != 0 {
+		resp.StatusCode = m.status
+		resp.Status = fmt.Sprintf("%d", m.status)
+	}
+	return resp, nil
+}
+
+func (m *mock) Output(_ string, args ...string) ([]byte, error) {
+	m.args = args
+	return m.payload, nil
+}
+
+func platform(format string) string {
+	return fmt.Sprintf(format, core.BaseTemplate.OS, core.BaseTemplate.Arch)
+}
+
+func TestGenerateErrors(t *testing.T) {
+	r := &retriever.ResourceFetcher{Backend: &mock{}}
+	if _, err := scaffold.Generate(r, " ", ""); err == nil || err.Error() != "source url is required" {
+		t.Errorf("invalid error: %v", err)
+	}
+	if _, err := scaffold.Generate(nil, "a", ""); err == nil || err.Error() != "retriever is required" {
+		t.Errorf("invalid error: %v", err)
+	}
+	if _, err := scaffold.Generate(r, "https://github.com/abc", ""); err == nil || err.Error() != "invalid github project: abc" {
+		t.Errorf("invalid error: %v", err)
+	}
+	if _, err := scaffold.Generate(r, "abc", ""); err == nil || err.Error() != "unable to detect source type: abc" {
+		t.Errorf("invalid error: %v", err)
+	}
+}
+
+func TestGitHub(t *testing.T) {
+	m := &mock{}
+	r := &retriever.ResourceFetcher{Backend: m}
+	asset := platform("tool-1.2.3-%s-%s.tar.gz")
+	m.payload = []byte(fmt.Sprintf(`{"tag_name": "v1.2.3", "assets": [{"browser_download_url": "x/%s"}, {"browser_download_url": "x/%s.sha256"}, {"browser_download_url": "x/other.zip"}]}`, asset, asset))
+	d, err := scaffold.Generate(r, "https://github.com/owner/Tool.git", "")
+	if err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if m.req.URL.String() != "https://api.github.com/repos/owner/Tool/releases/latest" {
+		t.Errorf("invalid request: %v", m.req.URL)
+	}
+	if d.Name != "tool" || d.Mode != "github" || d.Project != "owner/Tool" || d.Tag != "v1.2.3" || d.SkipExtract {
+		t.Errorf("invalid definition: %v", d)
+	}
+	if d.Asset != `tool-(.+?)-{{ $.OS }}-{{ $.Arch }}\.tar\.gz$` {
+		t.Errorf("invalid asset: %s", d.Asset)
+	}
+	for _, source := range []string{"git@github.com:owner/Tool.git", "ssh://git@github.com/owner/Tool"} {
+		m.req = nil
+		d, err = scaffold.Generate(r, source, "")
+		if err != nil || m.req == nil || m.req.URL.String() != "https://api.github.com/repos/owner/Tool/releases/latest" {
+			t.Errorf("invalid request: %s %v", source, err)
+		}
+		if d.Name != "tool" || d.Mode != "github" || d.Project != "owner/Tool" || d.Source != source {
+			t.Errorf("invalid definition: %v", d)
+		}
+	}
+	m.payload = []byte(`{"tag_name": "v1.2.3", "assets": []}`)
+	d, _ = scaffold.Generate(r, "https://github.com/owner/Tool", "name")
+	if d.Name != "name" || d.Asset != "tarball" {
+		t.Errorf("invalid definition: %v", d)
+	}
+	m.payload = []byte(`{"tag_name": "v1.2.3", "assets": [{"browser_download_url": "x/other.zip"}]}`)
+	d, _ = scaffold.Generate(r, "https://github.com/owner/Tool", "name")
+	if d.Asset != ".*" || len(d.Notes) != 2 {
+		t.Errorf("invalid definition: %v", d)
+	}
+	m.payload = []byte(`{}`)
+	if _, err := scaffold.Generate(r, "https://github.com/owner/Tool", "name"); err == nil || err.Error() != "no release tag found" {
+		t.Errorf("invalid error: %v", err)
+	}
+}
+
+func TestGitLab(t *testing.T) {
+	m := &mock{}
+	r := &retriever.ResourceFetcher{Backend: m}
+	asset := platform("tool-%s-%s.zip")
+	m.payload = []byte(fmt.Sprintf(`{"tag_name": "v1.2.3", "assets": {"links": [{"name": "%s", "direct_asset_url": "https://dl/v1.2.3/%s"}], "sources": [{"format": "tar.gz", "url": "https://src/1.2.3.tar.gz"}]}}`, asset, asset))
+	d, err := scaffold.Generate(r, "https://gitlab.com/group/tool", "")
+	if err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if m.req.URL.String() != "https://gitlab.com/api/v4/projects/group%2Ftool/releases/permalink/latest" {
+		t.Errorf("invalid request: %v", m.req.URL)
+	}
+	if d.Mode != "git" || d.Repository != "https://gitlab.com/group/tool.git" || d.Download != "https://dl/{{ $.Vars.Tag }}/"+asset || fmt.Sprintf("%v", d.Filters) != `[^v[0-9]+\.[0-9]+\.[0-9]+$]` {
+		t.Errorf("invalid definition: %v", d)
+	}
+	d, _ = scaffold.Generate(r, "git@gitlab.com:group/tool.git", "")
+	if m.req.URL.String() != "https://gitlab.com/api/v4/projects/group%2Ftool/releases/permalink/latest" || d.Mode != "git" || d.Repository != "https://gitlab.com/group/tool.git" {
+		t.Errorf("invalid definition: %v (%v)", d, m.req.URL)
+	}
+	m.payload = []byte(`{"tag_name": "v1.2.3", "assets": {"sources": [{"format": "tar.gz", "url": "https://src/1.2.3.tar.gz"}]}}`)
+	d, _ = scaffold.Generate(r, "https://gitlab.com/group/tool", "")
+	if d.Download != "https://src/{{ $.Vars.Tag.Full }}.tar.gz" {
+		t.Errorf("invalid definition: %v", d)
+	}
+	m.status = http.StatusNotFound
+	if _, err := scaffold.Generate(r, "https://gitlab.com/group/tool", ""); err == nil || err.Error() != "unable to get latest gitlab release: 404" {
+		t.Errorf("invalid error: %v", err)
+	}
+}
+
+func TestGit(t *testing.T) {
+	m := &mock{}
+	r := &retriever.ResourceFetcher{Backend: m}
+	m.payload = []byte("abc\trefs/tags/v2.0^{}\nabc\trefs/tags/v2.0\nxyz\trefs/tags/v1.9\n")
+	d, err := scaffold.Generate(r, "git@host:owner/repo.git", "")
+	if err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if d.Name != "repo" || d.Mode != "git" || d.Tag != "v2.0" || d.Repository != "git@host:owner/repo.git" || fmt.Sprintf("%v", d.Filters) != `[^v[0-9]+\.[0-9]+$]` {
+		t.Errorf("invalid definition: %v", d)
+	}
+	if m.args[len(m.args)-1] != "git@host:owner/repo.git" {
+		t.Errorf("invalid args: %v", m.args)
+	}
+	m.payload = []byte("")
+	if _, err := scaffold.Generate(r, "ssh://host/repo", ""); err == nil || err.Error() != "no tags found" {
+		t.Errorf("invalid error: %v", err)
+	}
+}
+
+func TestWeb(t *testing.T) {
+	m := &mock{}
+	r := &retriever.ResourceFetcher{Backend: m}
+	m.payload = []byte(`<a href="bash-5.1.tar.gz">a</a><a href="bash-5.2.37.tar.gz">b</a><a href="bash-5.2.37.tar.gz.sig">c</a><a href="/other/">d</a>`)
+	d, err := scaffold.Generate(r, "https://ftp.gnu.org/gnu/bash/", "")
+	if err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if d.Name != "bash" || d.Mode != "web" || d.Tag != "5.2.37" || d.Sort != "semver" || d.URL != "https://ftp.gnu.org/gnu/bash/" {
+		t.Errorf("invalid definition: %v", d)
+	}
+	if d.Download != "https://ftp.gnu.org/gnu/bash/bash-{{ $.Vars.Tag.Full }}.tar.gz" || fmt.Sprintf("%v", d.Filters) != `[bash-([0-9]+(?:\.[0-9]+)+)\.tar\.gz]` {
+		t.Errorf("invalid definition: %v", d)
+	}
+	var buf bytes.Buffer
+	if err := d.Write(&buf); err != nil || !strings.Contains(buf.String(), "[apps.bash.web]") {
+		t.Errorf("invalid write: %v %s", err, buf.String())
+	}
+	m.payload = []byte(`<a href="/other/">d</a>`)
+	if _, err := scaffold.Generate(r, "https://ftp.gnu.org/gnu/bash/", ""); err == nil || err.Error() != "no versioned links found" {
+		t.Errorf("invalid error: %v", err)
+	}
+	m.payload = []byte(`<a href="/notes-1.2.html">d</a>`)
+	if _, err := scaffold.Generate(r, "https://ftp.gnu.org/gnu/bash/", ""); err == nil || err.Error() != "no downloadable links found" {
+		t.Errorf("invalid error: %v", err)
+	}
+}
@@ -4,6 +4,7 @@ package steps
 import (
 	"errors"
 	"fmt"
+	"io"
 	"path/filepath"
 
 	"github.com/seanenck/blap/internal/cli"
@@ -13,7 +14,7 @@ import (
 type (
 	// Fetcher allows for wrapping calls
 	Fetcher interface {
-		Download(bool, string, string) (bool, error)
+		Download(bool, string, string, ...string) (bool, error)
 	}
 	// Variables define step variables for command templating
 	Variables struct {
@@ -32,8 +33,10 @@ type (
 	}
 	// Context are step settings/context
 	Context struct {
-		Settings  cli.Settings
-		Variables core.Values[Variables]
+		Settings    cli.Settings
+		Variables   core.Values[Variables]
+		Environment core.Environment
+		Output      io.Writer
 	}
 )
 
@@ -13,7 +13,7 @@ type mockFetch struct {
 	to  string
 }
 
-func (m *mockFetch) Download(dryrun bool, from string, to string) (bool, error) {
+func (m *mockFetch) Download(dryrun bool, from string, to string, _ ...string) (bool, error) {
 	m.to = to
 	return false, m.err
 }
@@ -18,8 +18,7 @@ func Do(steps []core.Step, builder util.Runner, ctx Context, e core.CommandEnv)
 	if err := ctx.Valid(); err != nil {
 		return err
 	}
-	environ := e.Variables.Set()
-	defer environ.Unset()
+	env := ctx.Environment.With(e.Variables)
 	for _, step := range steps {
 		for cmd := range step.Steps() {
 			if len(cmd) == 0 {
@@ -27,7 +26,7 @@ func Do(steps []core.Step, builder util.Runner, ctx Context, e core.CommandEnv)
 			}
 			to := ctx.Variables.Vars.Directories.Root
 			if step.Directory != "" {
-				sub, err := ctx.Variables.Template(step.Directory.String())
+				sub, err := ctx.Variables.WithEnvironment(env).Template(step.Directory.Expand(env.Getenv))
 				if err != nil {
 					return err
 				}
@@ -39,10 +38,11 @@ func Do(steps []core.Step, builder util.Runner, ctx Context, e core.CommandEnv)
 			if err != nil {
 				return err
 			}
+			v = v.WithEnvironment(env)
 			template := func(in string) (string, error) {
 				return v.Template(in)
 			}
-			exe, err := template(cmd[0].String())
+			exe, err := template(cmd[0].Expand(env.Getenv))
 			if err != nil {
 				return err
 			}
@@ -51,14 +51,14 @@ func Do(steps []core.Step, builder util.Runner, ctx Context, e core.CommandEnv)
 				if idx == 0 {
 					continue
 				}
-				res := a.String()
+				res := a.Expand(env.Getenv)
 				t, err := template(res)
 				if err != nil {
 					return err
 				}
 				args = append(args, t)
 			}
-			if err := runStep(ctx, builder, to, exe, args, step.CommandEnv(), step.ClearEnv || e.Clear); err != nil {
+			if err := runStep(ctx, builder, to, exe, args, env.With(step.Variables), step.ClearEnv || e.Clear); err != nil {
 				return err
 			}
 		}
@@ -66,15 +66,15 @@ func Do(steps []core.Step, builder util.Runner, ctx Context, e core.CommandEnv)
 	return nil
 }
 
-func runStep(ctx Context, builder util.Runner, to, exe string, args []string, env core.CommandEnv, doClear bool) error {
-	environ := env.Variables.Set()
-	defer environ.Unset()
+func runStep(ctx Context, builder util.Runner, to, exe string, args []string, env core.Environment, doClear bool) error {
 	run := util.RunSettings{}
 	run.Dir = to
+	run.Output = ctx.Output
 	if doClear {
 		run.Env.Clear = true
 	}
-	ctx.Settings.LogDebug(logging.BuildCategory, "run: %v\n", run)
+	run.Env.Values = env.Environ(doClear)
+	ctx.Settings.LogDebug(logging.BuildCategory, "run: %s (clear env: %v)\n", run.Dir, run.Env.Clear)
 	ctx.Settings.LogDebug(logging.BuildCategory, "command: %s (%v)\n", exe, args)
 	return builder.Run(run, exe, args...)
 }
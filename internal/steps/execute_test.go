@@ -1,6 +1,7 @@
 package steps_test
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"testing"
@@ -23,7 +24,7 @@ func (m *mockRun) Run(s util.RunSettings, c string, args ...string) error {
 	m.lastDir = s.Dir
 	m.lastArgs = args
 	m.lastCmd = c
-	m.lastEnv = os.Environ()
+	m.lastEnv = s.Env.Values
 	m.lastClear = s.Env.Clear
 	return nil
 }
@@ -32,6 +33,10 @@ func (m *mockRun) RunCommand(string, ...string) error {
 	return nil
 }
 
+func (m *mockRun) WithContext(context.Context) util.Runner {
+	return m
+}
+
 func (m *mockRun) Output(string, ...string) ([]byte, error) {
 	return nil, nil
 }
@@ -50,6 +55,7 @@ func TestDo(t *testing.T) {
 	vars.File = "A"
 	e, _ := core.NewValues("xyz", vars)
 	step.Variables = e
+	step.Environment = core.NewEnvironment(os.Environ())
 	if err := steps.Do([]core.Step{{}, {Directory: "{{ $.Name }}", Commands: []interface{}{"~/exe/{{ $.Vars.Directories.Working }}", `~/{{ if eq $.Arch "fakearch" }}{{else}}{{ $.Vars.File }}{{end}}`}}}, m, step, core.CommandEnv{}); err != nil {
 		t.Errorf("invalid error: %v", err)
 	}
@@ -105,10 +111,7 @@ func TestEnv(t *testing.T) {
 		t.Errorf("invalid cmd: %s", m.lastCmd)
 	}
 	v := core.Variables{}
-	v = append(v, struct {
-		Key   string
-		Value core.Resolved
-	}{"HOME", "1"})
+	v = append(v, core.Variable{Key: "HOME", Value: "1"})
 	if err := steps.Do([]core.Step{{}, {Variables: v, Commands: []interface{}{"~/exe", "~/{{ $.Name }}"}}}, m, step, core.CommandEnv{}); err != nil {
 		t.Errorf("invalid error: %v", err)
 	}
@@ -117,34 +120,37 @@ func TestEnv(t *testing.T) {
 	}
 	s := core.CommandEnv{}
 	v = core.Variables{}
-	v = append(v, struct {
-		Key   string
-		Value core.Resolved
-	}{"HOME", "y"})
+	v = append(v, core.Variable{Key: "HOME", Value: "y"})
 	if err := steps.Do([]core.Step{{}, {Variables: v, Commands: []interface{}{"~/exe", "~/{{ $.Name }}"}}}, m, step, s); err != nil {
 		t.Errorf("invalid error: %v", err)
 	}
 	if m.lastClear || len(m.lastEnv) != 1 {
 		t.Errorf("invalid env: %v %v", m.lastClear, m.lastEnv)
 	}
-	v = append(v, struct {
-		Key   string
-		Value core.Resolved
-	}{"XYZ", "aaa"})
+	v = append(v, core.Variable{Key: "XYZ", Value: "aaa"})
 	if err := steps.Do([]core.Step{{}, {Variables: v, Commands: []interface{}{"~/exe", "~/{{ $.Name }}"}}}, m, step, s); err != nil {
 		t.Errorf("invalid error: %v", err)
 	}
 	if m.lastClear || len(m.lastEnv) != 2 {
 		t.Errorf("invalid env: %v %v", m.lastClear, m.lastEnv)
 	}
-	v = append(v, struct {
-		Key   string
-		Value core.Resolved
-	}{"ZZZ", "aaz"})
+	v = append(v, core.Variable{Key: "ZZZ", Value: "aaz"})
 	if err := steps.Do([]core.Step{{}, {Variables: v, Commands: []interface{}{"~/exe", "~/{{ $.Name }}"}}}, m, step, s); err != nil {
 		t.Errorf("invalid error: %v", err)
 	}
 	if m.lastClear || len(m.lastEnv) != 3 {
 		t.Errorf("invalid env: %v %v", m.lastClear, m.lastEnv)
 	}
+	step.Environment = core.NewEnvironment([]string{"HOME=h"}).With(core.Variables{{Key: "GLOBAL", Value: "g"}})
+	app := core.CommandEnv{Variables: core.Variables{{Key: "APP", Value: "$GLOBAL-a"}}}
+	v = core.Variables{{Key: "STEP", Value: "$APP-s"}}
+	if err := steps.Do([]core.Step{{ClearEnv: true, Variables: v, Commands: []interface{}{"exe", "$APP", `{{ $.Getenv "GLOBAL" }}`}}}, m, step, app); err != nil {
+		t.Errorf("invalid error: %v", err)
+	}
+	if fmt.Sprintf("%v", m.lastEnv) != "[GLOBAL=g APP=g-a STEP=g-a-s]" || fmt.Sprintf("%v", m.lastArgs) != "[g-a g]" {
+		t.Errorf("invalid env: %v %v", m.lastEnv, m.lastArgs)
+	}
+	if os.Getenv("GLOBAL") != "" || os.Getenv("APP") != "" || os.Getenv("STEP") != "" {
+		t.Error("process environment was modified")
+	}
 }
@@ -2,18 +2,25 @@
 package util
 
 import (
+	"context"
+	"io"
 	"os"
 	"os/exec"
 )
 
 type (
 	// CommandRunner is the default command runner
-	CommandRunner struct{}
+	CommandRunner struct {
+		ctx context.Context
+	}
 	// RunSettings configure how a command is run
 	RunSettings struct {
-		Dir string
-		Env struct {
-			Clear bool
+		Dir    string
+		Input  io.Reader
+		Output io.Writer
+		Env    struct {
+			Clear  bool
+			Values []string
 		}
 	}
 	// Runner is the runner interface for exec'ing
@@ -21,19 +28,39 @@ type (
 		RunCommand(string, ...string) error
 		Output(string, ...string) ([]byte, error)
 		Run(RunSettings, string, ...string) error
+		WithContext(context.Context) Runner
 	}
 )
 
+// WithContext will create a runner that stops commands when the context is done
+func (r CommandRunner) WithContext(ctx context.Context) Runner {
+	return CommandRunner{ctx: ctx}
+}
+
+func (r CommandRunner) command(cmd string, args ...string) *exec.Cmd {
+	if r.ctx == nil {
+		return exec.Command(cmd, args...)
+	}
+	return exec.CommandContext(r.ctx, cmd, args...)
+}
+
 // Run will run a command with settings
 func (r CommandRunner) Run(settings RunSettings, cmd string, args ...string) error {
-	c := exec.Command(cmd, args...)
+	c := r.command(cmd, args...)
 	c.Stdout = os.Stdout
 	c.Stderr = os.Stderr
+	if settings.Output != nil {
+		c.Stdout = settings.Output
+		c.Stderr = settings.Output
+	}
+	if settings.Input != nil {
+		c.Stdin = settings.Input
+	}
 	if settings.Dir != "" {
 		c.Dir = settings.Dir
 	}
-	if settings.Env.Clear {
-		c.Env = []string{}
+	if settings.Env.Clear || len(settings.Env.Values) > 0 {
+		c.Env = append([]string{}, settings.Env.Values...)
 	}
 	return c.Run()
 }
@@ -45,5 +72,55 @@ func (r CommandRunner) RunCommand(cmd string, args ...string) error {
 
 // Output will get command output
 func (r CommandRunner) Output(cmd string, args ...string) ([]byte, error) {
-	return exec.Command(cmd, args...).Output()
+	return r.command(cmd, args...).Output()
+}
+
+type outputRunner struct {
+	Runner
+	output io.Writer
+}
+
+// WithOutput will create a runner that writes command output (stdout/stderr) to a writer
+func WithOutput(r Runner, w io.Writer) Runner {
+	return outputRunner{r, w}
+}
+
+func (o outputRunner) Run(settings RunSettings, cmd string, args ...string) error {
+	if settings.Output == nil {
+		settings.Output = o.output
+	}
+	return o.Runner.Run(settings, cmd, args...)
+}
+
+func (o outputRunner) RunCommand(cmd string, args ...string) error {
+	return o.Run(RunSettings{}, cmd, args...)
+}
+
+func (o outputRunner) WithContext(ctx context.Context) Runner {
+	return WithOutput(o.Runner.WithContext(ctx), o.output)
+}
+
+type environmentRunner struct {
+	Runner
+	env []string
+}
+
+// WithEnvironment will create a runner that uses an environment for commands that do not set one
+func WithEnvironment(r Runner, env []string) Runner {
+	return environmentRunner{r, env}
+}
+
+func (e environmentRunner) Run(settings RunSettings, cmd string, args ...string) error {
+	if !settings.Env.Clear && len(settings.Env.Values) == 0 {
+		settings.Env.Values = e.env
+	}
+	return e.Runner.Run(settings, cmd, args...)
+}
+
+func (e environmentRunner) RunCommand(cmd string, args ...string) error {
+	return e.Run(RunSettings{}, cmd, args...)
+}
+
+func (e environmentRunner) WithContext(ctx context.Context) Runner {
+	return WithEnvironment(e.Runner.WithContext(ctx), e.env)
 }